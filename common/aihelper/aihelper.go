@@ -5,44 +5,129 @@ package aihelper //AI会话助手层
 //3.统一消息的存储策略
 //4.支持同步与流式两种生成方式
 import (
-	"GopherAI/common/rabbitmq" //消息异步存储实现
-	"GopherAI/model"           //业务层消息结构
-	"GopherAI/utils"           //Message和SchemaMessage转换工具
+	"GopherAI/common/attachment" //聊天图片的文件存储
+	"GopherAI/common/rabbitmq"   //消息异步存储实现
+	"GopherAI/common/rag"        //知识库检索
+	"GopherAI/common/redis"      //每日token额度计数
+	"GopherAI/dao/session"       //会话摘要存储
+	"GopherAI/model"             //业务层消息结构
+	"GopherAI/utils"             //Message和SchemaMessage转换工具
 	"context"
-	"sync"
-	"log"
 	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	einomodel "github.com/cloudwego/eino/components/model" //与业务层的model包重名，起别名
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
 )
 
+// GenerationParams 生成参数，为空的字段使用模型的默认值
+type GenerationParams struct {
+	Temperature *float32
+	TopP        *float32
+	MaxTokens   *int
+}
+
+// 转换成eino的调用参数
+func (p GenerationParams) options() []einomodel.Option {
+	var opts []einomodel.Option
+	if p.Temperature != nil {
+		opts = append(opts, einomodel.WithTemperature(*p.Temperature))
+	}
+	if p.TopP != nil {
+		opts = append(opts, einomodel.WithTopP(*p.TopP))
+	}
+	if p.MaxTokens != nil {
+		opts = append(opts, einomodel.WithMaxTokens(*p.MaxTokens))
+	}
+	return opts
+}
+
 // AIHelper AI助手结构体，包含消息历史和AI模型
 type AIHelper struct {
-	model    AIModel          //接口类型，OpenAIModel和OllamaModel都实现了该接口
-	messages []*model.Message //会话中的历史消息
-	mu       sync.RWMutex
+	model AIModel //接口类型，OpenAIModel和OllamaModel都实现了该接口
+	//会话是一棵消息树：编辑、重新生成会在同一位置产生新的分支，上下文只取当前分支
+	messages   []*model.Message            //会话中的所有消息（按加入顺序）
+	nodes      map[string]*model.Message   //MessageID -> 消息
+	children   map[string][]*model.Message //父消息ID -> 子消息（按加入顺序），根消息的父ID为空
+	activeLeaf string                      //当前分支的最后一条消息
+	leafFunc   func(sessionID string, leafID string) error
+	mu         sync.RWMutex
 	//一个会话绑定一个AIHelper
 	SessionID string
 	//通过函数指针解耦存储实现，避免循环依赖（可以是数据库，MQ，也可以是同步或异步）
 	saveFunc func(*model.Message) (*model.Message, error)
+	tools    *ToolRegistry //模型可调用的工具
+	//上下文策略，同步和流式生成共用，决定每次请求带上哪些历史消息
+	contextStrategy ContextStrategy
+
+	//人设：系统提示词会放在每次请求的最前面
+	personaID          uint
+	systemPrompt       string
+	personaTemperature *float32         //人设的温度，会话没有单独设置温度时使用
+	params             GenerationParams //会话的生成参数
+
+	//滚动摘要：从根到summarizedUntil（含）的消息已被压缩进summary，只对经过该消息的分支生效
+	summary         string
+	summarizedUntil string
+	summarizing     atomic.Bool //是否有摘要任务正在后台执行
+	summaryFunc     func(sessionID string, summary string, summarizedUntil string) error
+
+	usageFunc func(userName string, tokens int) error //记录token消耗，用于每日额度
+
+	//会话标题：第一轮对话后自动生成一次
+	titled    atomic.Bool
+	titleFunc func(sessionID string, title string) (bool, error)
+
+	//知识库：每轮对话先检索挂载的知识库，检索结果作为资料放进上下文
+	knowledgeBaseIDs []uint
+	retriever        Retriever
+
+	loadAttachment func(id string) ([]byte, error) //读取图片内容
 }
 
+// ErrMessageNotFound 要编辑或重新生成的消息不存在
+var ErrMessageNotFound = errors.New("message not found")
+
 // NewAIHelper 创建新的AIHelper实例
 func NewAIHelper(model_ AIModel, SessionID string) *AIHelper {
 	return &AIHelper{
 		model:    model_,
 		messages: make([]*model.Message, 0),
+		nodes:    make(map[string]*model.Message),
+		children: make(map[string][]*model.Message),
 		//异步推送到消息队列中
 		saveFunc: func(msg *model.Message) (*model.Message, error) {
-			data := rabbitmq.GenerateMessageMQParam(msg.SessionID, msg.Content, msg.UserName, msg.IsUser)
+			data := rabbitmq.GenerateMessageMQParam(msg)
 			//将消息序列化为JSON格式
 			if rabbitmq.RMQMessage == nil {
-        		log.Println("警告: RabbitMQ 未初始化，消息未能发送到队列")
-        		return msg, errors.New("RabbitMQ is not initialized")
-    		}//防止全局变量没有初始化，调用Publish方法后出现panic
+				log.Println("警告: RabbitMQ 未初始化，消息未能发送到队列")
+				return msg, errors.New("RabbitMQ is not initialized")
+			} //防止全局变量没有初始化，调用Publish方法后出现panic
 			err := rabbitmq.RMQMessage.Publish(data)
 			//发布消息到MQ
 			return msg, err
 		},
 		SessionID: SessionID,
+		tools:     GetGlobalToolRegistry(),
+		//默认按配置文件中的token预算截取上下文
+		contextStrategy: NewDefaultContextStrategy(),
+		//摘要直接写回会话表
+		summaryFunc: session.UpdateSessionSummary,
+		//token消耗累加到Redis，供限流中间件检查每日额度
+		usageFunc: redis.AddDailyTokens,
+		//当前分支写回会话表
+		leafFunc: session.UpdateActiveLeaf,
+		//生成的标题写回会话表
+		titleFunc: session.UpdateGeneratedTitle,
+		//检索全局向量索引
+		retriever: rag.Retriever{},
+		//从磁盘读取聊天图片
+		loadAttachment: attachment.Load,
 	}
 }
 
@@ -54,103 +139,296 @@ func (a *AIHelper) AddMessage(Content string, UserName string, IsUser bool, Save
 		UserName:  UserName,
 		IsUser:    IsUser,
 	}
+	a.addMessage(&userMsg, Save)
+}
+
+// 追加一条完整的消息（工具调用、工具结果等需要额外字段的消息走这里）
+// 新消息接在当前分支的末尾，并成为新的分支末尾
+func (a *AIHelper) addMessage(msg *model.Message, Save bool) {
+	msg.SessionID = a.SessionID
+	if msg.MessageID == "" {
+		msg.MessageID = uuid.New().String()
+	}
 
-	a.mu.Lock()//加上写锁，保证并发安全
-	a.messages = append(a.messages, &userMsg) //向内存中追加消息
+	a.mu.Lock() //加上写锁，保证并发安全
+	msg.ParentID = a.activeLeaf
+	//创建时间随消息入库，数据库按创建时间排序；保证晚于父消息（精确到毫秒），和内存中的顺序一致
+	msg.CreatedAt = time.Now().Truncate(time.Millisecond)
+	if parent, ok := a.nodes[msg.ParentID]; ok && !msg.CreatedAt.After(parent.CreatedAt) {
+		msg.CreatedAt = parent.CreatedAt.Add(time.Millisecond)
+	}
+	a.insertNode(msg) //向内存中追加消息
 	a.mu.Unlock()
 
 	if Save {
-		a.saveFunc(&userMsg) //调用存储函数（持久化）
+		//调用存储函数（持久化）
+		if _, err := a.saveFunc(msg); err != nil {
+			log.Printf("[AIHelper] session=%s save message=%s failed: %v\n", a.SessionID, msg.MessageID, err)
+		}
 	}
 }
 
+// LoadMessage 把从数据库恢复的消息加入消息树（不再重复持久化），最后加载的消息默认为当前分支末尾
+func (a *AIHelper) LoadMessage(msg *model.Message) {
+	msg.SessionID = a.SessionID
+	a.mu.Lock()
+	a.insertNode(msg)
+	a.mu.Unlock()
+}
+
 // SaveMessage 保存消息到数据库（通过回调函数避免循环依赖）
 // 通过传入func，自己调用外部的保存函数，即可支持同步异步等多种策略
 func (a *AIHelper) SetSaveFunc(saveFunc func(*model.Message) (*model.Message, error)) {
 	a.saveFunc = saveFunc
 }
 
-// GetMessages 获取所有消息历史
-// 返回的是“拷贝”，避免外部修改内部状态，使用读锁保证并发安全
-func (a *AIHelper) GetMessages() []*model.Message {
+// SetToolRegistry 指定该会话可调用的工具（默认使用全局工具注册中心）
+func (a *AIHelper) SetToolRegistry(tools *ToolRegistry) {
+	a.tools = tools
+}
+
+// SetContextStrategy 替换上下文策略（不同模型的上下文窗口大小不同）
+func (a *AIHelper) SetContextStrategy(strategy ContextStrategy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.contextStrategy = strategy
+}
+
+// SetPersona 设置会话人设，每次调用模型时人设的系统消息都会放在最前面
+func (a *AIHelper) SetPersona(personaID uint, systemPrompt string, temperature *float32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.personaID = personaID
+	a.systemPrompt = systemPrompt
+	a.personaTemperature = temperature
+}
+
+// SetParams 设置会话的生成参数（整体替换）
+func (a *AIHelper) SetParams(params GenerationParams) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.params = params
+}
+
+// GetParams 获取会话的生成参数
+func (a *AIHelper) GetParams() GenerationParams {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	out := make([]*model.Message, len(a.messages))
-	copy(out, a.messages)
-	return out
+	return a.params
 }
 
-// 同步生成
-func (a *AIHelper) GenerateResponse(userName string, ctx context.Context, userQuestion string) (*model.Message, error) {
+// 切换会话使用的模型，已经在进行的生成不受影响，下一轮调用开始使用新模型
+func (a *AIHelper) setModel(model_ AIModel, strategy ContextStrategy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.model = model_
+	a.contextStrategy = strategy
+}
 
-	//调用存储函数
-	a.AddMessage(userQuestion, userName, true, true)
+// 当前使用的模型
+func (a *AIHelper) currentModel() AIModel {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.model
+}
 
+// GetPersonaID 获取会话使用的人设ID，0表示没有人设
+func (a *AIHelper) GetPersonaID() uint {
 	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.personaID
+}
 
-	var recentMessages []*model.Message
-	if len(a.messages) > 20{
-		recentMessages = a.messages[len(a.messages)-20:]
-	}else{
-		recentMessages = a.messages
-	}
+// GetMessages 获取当前分支的消息历史（从第一条消息到当前分支末尾）
+// 返回的是“拷贝”，避免外部修改内部状态，使用读锁保证并发安全
+func (a *AIHelper) GetMessages() []*model.Message {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.activePath()
+}
 
+// 按上下文策略挑选本次发送给模型的消息，extra为本轮额外的系统消息（如检索到的资料）
+func (a *AIHelper) buildContext(extra ...*schema.Message) []*schema.Message {
+	a.mu.RLock()
+	//只取当前分支，已被摘要的消息不再发送，用摘要代替
+	path := a.activePath()
+	start := a.summarizedIndex(path) + 1
 	//将model.Message转化成schema.Message
-	messages := utils.ConvertToSchemaMessages(recentMessages)
+	recent := path[start:]
+	history := utils.ConvertToSchemaMessages(recent)
+	var system []*schema.Message
+	if a.systemPrompt != "" {
+		system = append(system, schema.SystemMessage(a.systemPrompt))
+	}
+	if start > 0 {
+		system = append(system, a.summaryMessages()...)
+	}
+	system = append(system, extra...)
+	strategy := a.contextStrategy
 	a.mu.RUnlock()
 
-	//调用模型生成回复
-	schemaMsg, err := a.model.GenerateResponse(ctx, messages)
-	if err != nil {
-		return nil, err
+	a.applyAttachments(history, recent) //读取图片文件，不在锁内进行
+	return strategy.Build(system, history)
+}
+
+// 本轮调用的参数：生成参数 + 需要绑定的工具，超过最大轮数后不再绑定工具，迫使模型给出最终回答
+func (a *AIHelper) callOptions(round int) []einomodel.Option {
+	a.mu.RLock()
+	params := a.params
+	if params.Temperature == nil {
+		params.Temperature = a.personaTemperature
 	}
+	a.mu.RUnlock()
+	opts := params.options()
 
-	//将schema.Message转化成model.Message
-	modelMsg := utils.ConvertToModelMessage(a.SessionID, userName, schemaMsg)
+	if a.tools == nil || round >= maxToolRounds {
+		return opts
+	}
+	infos := a.tools.ToolInfos()
+	if len(infos) == 0 {
+		return opts
+	}
+	return append(opts, einomodel.WithTools(infos))
+}
 
-	//调用存储函数
-	a.AddMessage(modelMsg.Content, userName, false, true)
+// 把模型回复转换成要保存的消息，记录作答模型、token用量和耗时
+func (a *AIHelper) newReplyMessage(userName string, llm AIModel, resp *schema.Message, input []*schema.Message, latency time.Duration) *model.Message {
+	msg := utils.ConvertToModelMessage(a.SessionID, userName, resp)
+	msg.ModelID = AnsweredBy(resp, llm)
+	msg.LatencyMs = latency.Milliseconds()
 
-	return modelMsg, nil
+	//部分模型不返回用量，按估算值记录，保证计费统计不漏算
+	if msg.TotalTokens == 0 {
+		tokenizer := EstimateTokenizer{}
+		for _, m := range input {
+			msg.PromptTokens += messageOverheadTokens + tokenizer.CountTokens(m.Content)
+		}
+		msg.CompletionTokens = tokenizer.CountTokens(resp.Content)
+		for _, call := range resp.ToolCalls {
+			msg.CompletionTokens += tokenizer.CountTokens(call.Function.Name) + tokenizer.CountTokens(call.Function.Arguments)
+		}
+		msg.TotalTokens = msg.PromptTokens + msg.CompletionTokens
+	}
+	return msg
 }
 
-// 流式生成
-func (a *AIHelper) StreamResponse(userName string, ctx context.Context, cb StreamCallback, userQuestion string) (*model.Message, error) {
-
-	//调用存储函数
-	a.AddMessage(userQuestion, userName, true, true)
+// 执行模型发起的工具调用，工具结果作为消息保存下来
+func (a *AIHelper) runTools(ctx context.Context, userName string, calls []schema.ToolCall) {
+	for _, call := range calls {
+		result := a.tools.Execute(ctx, call)
+		log.Printf("[AIHelper] session=%s tool=%s called\n", a.SessionID, call.Function.Name)
+		a.addMessage(utils.ConvertToModelMessage(a.SessionID, userName, result), true)
+	}
+}
 
-	a.mu.RLock()
+// 保存模型回复，并累加本次消耗的token
+func (a *AIHelper) saveReply(userName string, replyMsg *model.Message) {
+	a.addMessage(replyMsg, true)
+	if a.usageFunc != nil {
+		if err := a.usageFunc(userName, replyMsg.TotalTokens); err != nil {
+			log.Printf("[AIHelper] session=%s record usage failed: %v\n", a.SessionID, err)
+		}
+	}
+}
 
-	var recentMessages []*model.Message
-	if len(a.messages) > 20{
-		recentMessages = a.messages[len(a.messages)-20:]
-	}else{
-		recentMessages = a.messages
+// 后台任务（摘要、标题）调用模型消耗的token同样计入用户的每日额度
+// 这些调用不产生消息，不出现在按消息统计的用量明细中
+func (a *AIHelper) recordBackgroundUsage(userName string, llm AIModel, resp *schema.Message, input []*schema.Message) {
+	if a.usageFunc == nil || userName == "" {
+		return
 	}
+	msg := a.newReplyMessage(userName, llm, resp, input, 0)
+	if err := a.usageFunc(userName, msg.TotalTokens); err != nil {
+		log.Printf("[AIHelper] session=%s record background usage failed: %v\n", a.SessionID, err)
+	}
+}
 
-	messages := utils.ConvertToSchemaMessages(recentMessages)
-	a.mu.RUnlock()
+// 生成一次完整的回复：模型返回工具调用时，执行工具后把结果带上继续请求，直到模型给出最终回答
+// cb为nil时同步生成，否则流式生成（每一轮的文本内容都会实时推送给前端）
+// 流式生成被取消时，已经推送的部分会作为截断的回复保存并返回
+func (a *AIHelper) respond(ctx context.Context, userName string, cb ReplyCallback) (*model.Message, error) {
+	defer a.saveActiveLeaf() //一次生成结束后记录当前分支
 
-	content, err := a.model.StreamResponse(ctx, messages, cb)
-	if err != nil {
-		return nil, err
+	//每轮对话只检索一次，工具调用后的后续请求沿用同一批资料
+	var extra []*schema.Message
+	sources := a.retrieve(ctx)
+	if len(sources) > 0 {
+		extra = append(extra, sourcesMessage(sources))
 	}
-	//转化成model.Message
-	modelMsg := &model.Message{
-		SessionID: a.SessionID,
-		UserName:  userName,
-		Content:   content,
-		IsUser:    false,
+	for round := 0; ; round++ {
+		messages := a.buildContext(extra...)
+		opts := a.callOptions(round)
+		llm := a.currentModel()
+		replyID := uuid.New().String() //先分配回复的ID，推送的内容和保存的消息对应
+
+		//调用模型生成回复
+		start := time.Now()
+		var resp *schema.Message
+		var err error
+		var partial strings.Builder //已经推送给前端的内容
+		if cb == nil {
+			resp, err = llm.GenerateResponse(ctx, messages, opts...)
+		} else {
+			resp, err = llm.StreamResponse(ctx, messages, func(msg string) {
+				partial.WriteString(msg)
+				cb(replyID, msg)
+			}, opts...)
+		}
+		if err != nil {
+			if ctx.Err() != nil && partial.Len() > 0 {
+				//保存已输出的部分并标记为截断，保证历史和前端看到的一致
+				replyMsg := a.newReplyMessage(userName, llm, schema.AssistantMessage(partial.String(), nil), messages, time.Since(start))
+				replyMsg.MessageID = replyID
+				replyMsg.Truncated = true
+				attachSources(replyMsg, sources)
+				a.saveReply(userName, replyMsg)
+				return replyMsg, nil
+			}
+			return nil, err
+		}
+
+		//超过工具调用轮数后不再绑定工具，模型（或故障转移中的备用模型）仍然返回工具调用时丢弃，作为最终回答
+		if round >= maxToolRounds && len(resp.ToolCalls) > 0 {
+			log.Printf("[AIHelper] session=%s tool rounds exceeded, %d tool calls dropped\n", a.SessionID, len(resp.ToolCalls))
+			resp.ToolCalls = nil
+		}
+
+		//将schema.Message转化成model.Message，并调用存储函数
+		replyMsg := a.newReplyMessage(userName, llm, resp, messages, time.Since(start))
+		replyMsg.MessageID = replyID
+		if len(resp.ToolCalls) == 0 {
+			attachSources(replyMsg, sources)
+		}
+		a.saveReply(userName, replyMsg)
+
+		if len(resp.ToolCalls) == 0 {
+			//后台检查是否需要压缩早期对话
+			a.maybeSummarize()
+			return replyMsg, nil
+		}
+		a.runTools(ctx, userName, resp.ToolCalls)
 	}
+}
+
+// 同步生成，attachments为用户消息附带的图片
+func (a *AIHelper) GenerateResponse(userName string, ctx context.Context, userQuestion string, attachments ...model.Attachment) (*model.Message, error) {
+
+	//调用存储函数
+	a.addMessage(newUserMessage(userQuestion, userName, attachments), true)
+
+	return a.respond(ctx, userName, nil)
+}
+
+// 流式生成，attachments为用户消息附带的图片
+func (a *AIHelper) StreamResponse(userName string, ctx context.Context, cb ReplyCallback, userQuestion string, attachments ...model.Attachment) (*model.Message, error) {
 
 	//调用存储函数
-	a.AddMessage(modelMsg.Content, userName, false, true)
+	a.addMessage(newUserMessage(userQuestion, userName, attachments), true)
 
-	return modelMsg, nil
+	return a.respond(ctx, userName, cb)
 }
 
 // GetModelType 获取模型类型
 func (a *AIHelper) GetModelType() string {
-	return a.model.GetModelType()
+	return a.currentModel().GetModelType()
 }
@@ -0,0 +1,99 @@
+package aihelper
+
+//用户消息附带的图片
+//支持识图的模型（配置vision = true）以多模态内容发送图片，其他模型只能看到文件名和本地分类结果
+import (
+	"GopherAI/config"
+	"GopherAI/model"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 构造带图片的用户消息
+func newUserMessage(content string, userName string, attachments []model.Attachment) *model.Message {
+	msg := &model.Message{
+		Content:  content,
+		UserName: userName,
+		IsUser:   true,
+	}
+	if len(attachments) > 0 {
+		data, err := json.Marshal(attachments)
+		if err != nil {
+			log.Println("newUserMessage marshal attachments error:", err)
+		} else {
+			msg.Attachments = string(data)
+		}
+	}
+	return msg
+}
+
+// DecodeAttachments 解析消息上的图片列表
+func DecodeAttachments(raw string) []model.Attachment {
+	if raw == "" {
+		return nil
+	}
+	var atts []model.Attachment
+	if err := json.Unmarshal([]byte(raw), &atts); err != nil {
+		log.Println("DecodeAttachments error:", err)
+		return nil
+	}
+	return atts
+}
+
+// 当前模型是否支持图片输入
+func (a *AIHelper) supportsVision() bool {
+	mc, ok := config.GetConfig().GetModelConfig(a.GetModelType())
+	return ok && mc.Vision
+}
+
+// 把消息上的图片放进发给模型的消息中，schemaMsgs与msgs一一对应
+func (a *AIHelper) applyAttachments(schemaMsgs []*schema.Message, msgs []*model.Message) {
+	vision := a.supportsVision()
+	for i, m := range msgs {
+		atts := DecodeAttachments(m.Attachments)
+		if len(atts) == 0 {
+			continue
+		}
+		if !vision {
+			schemaMsgs[i].Content += attachmentHint(atts)
+			continue
+		}
+
+		parts := []schema.MessageInputPart{{Type: schema.ChatMessagePartTypeText, Text: m.Content}}
+		for _, att := range atts {
+			data, err := a.loadAttachment(att.ID)
+			if err != nil {
+				log.Printf("[AIHelper] session=%s load attachment %s failed: %v\n", a.SessionID, att.ID, err)
+				parts[0].Text += attachmentHint([]model.Attachment{att})
+				continue
+			}
+			encoded := base64.StdEncoding.EncodeToString(data)
+			parts = append(parts, schema.MessageInputPart{
+				Type: schema.ChatMessagePartTypeImageURL,
+				Image: &schema.MessageInputImage{
+					MessagePartCommon: schema.MessagePartCommon{Base64Data: &encoded, MIMEType: att.MIMEType},
+				},
+			})
+		}
+		schemaMsgs[i].Content = ""
+		schemaMsgs[i].UserInputMultiContent = parts
+	}
+}
+
+// 模型看不到图片时，用文件名和本地分类结果提示
+func attachmentHint(atts []model.Attachment) string {
+	var b strings.Builder
+	for _, att := range atts {
+		if att.Label != "" {
+			fmt.Fprintf(&b, "\n[用户附带了一张图片《%s》，当前模型无法查看图片，本地识别结果为：%s]", att.FileName, att.Label)
+		} else {
+			fmt.Fprintf(&b, "\n[用户附带了一张图片《%s》，当前模型无法查看图片]", att.FileName)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,216 @@
+package aihelper
+
+//多实例部署：MySQL是会话的数据来源，各实例内存中的AIHelper只是缓存
+//1.修改会话（一轮对话、切换分支、修改配置）前获取Redis中的会话锁，同一时间只有一个实例修改同一个会话
+//2.修改完成后递增Redis中的会话版本号，并通过发布订阅通知其他实例丢弃缓存；访问缓存时核对版本号，错过通知也不会用到旧数据
+//3.消息直接同步写入MySQL（不经过消息队列），释放锁时数据库已经是最新状态
+//4.停止生成的请求可能落在其他实例上，通过同一个频道广播，由运行该生成的实例取消
+import (
+	"GopherAI/common/redis"
+	"GopherAI/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSessionBusy 等待会话锁超时
+var ErrSessionBusy = errors.New("session busy")
+
+// 本实例的标识，忽略自己发出的通知
+var instanceID = uuid.New().String()
+
+// 获取会话锁时的重试间隔
+const lockRetryInterval = 100 * time.Millisecond
+
+// 缓存失效通知，SessionID为空表示该用户的所有会话
+// Cancel为true时是停止生成的通知：GenerationID不为空时只停止该次生成，否则停止会话上的所有生成
+type invalidation struct {
+	Instance     string `json:"instance"`
+	UserName     string `json:"userName"`
+	SessionID    string `json:"sessionId,omitempty"`
+	Cancel       bool   `json:"cancel,omitempty"`
+	GenerationID string `json:"generationId,omitempty"`
+}
+
+func clusterEnabled() bool {
+	return config.GetConfig().ClusterConfig.Enabled
+}
+
+// LockSession 获取会话锁，返回释放函数：先取得本实例内的轮次锁（见turn.go），多实例部署时再取得Redis中的会话锁
+func LockSession(c context.Context, sessionID string) (func(), error) {
+	releaseTurn, err := acquireTurn(c, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !clusterEnabled() {
+		return releaseTurn, nil
+	}
+	unlock, err := lockCluster(c, sessionID)
+	if err != nil {
+		releaseTurn()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		releaseTurn()
+	}, nil
+}
+
+// 获取Redis中的会话锁，最多等待lockWaitSeconds，持有期间在后台自动续期
+func lockCluster(c context.Context, sessionID string) (func(), error) {
+	conf := config.GetConfig().ClusterConfig
+	ttl := time.Duration(conf.LockTTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	wait := time.Duration(conf.LockWaitSeconds) * time.Second
+
+	token := uuid.New().String()
+	deadline := time.Now().Add(wait)
+	for {
+		ok, err := redis.TryLockSession(sessionID, token, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrSessionBusy
+		}
+		select {
+		case <-c.Done():
+			return nil, c.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	//生成可能超过锁的过期时间，持有期间定时续期
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if ok, err := redis.RefreshSessionLock(sessionID, token, ttl); err != nil || !ok {
+					log.Printf("[Cluster] refresh lock session=%s failed: ok=%v err=%v\n", sessionID, ok, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		if err := redis.UnlockSession(sessionID, token); err != nil {
+			log.Printf("[Cluster] unlock session=%s failed: %v\n", sessionID, err)
+		}
+	}, nil
+}
+
+// Invalidate 会话在本实例修改后调用：递增版本号并通知其他实例丢弃缓存
+func (m *AIHelperManager) Invalidate(userName string, sessionID string) {
+	if !clusterEnabled() {
+		return
+	}
+	version, err := redis.IncrSessionVersion(sessionID)
+	if err != nil {
+		log.Printf("[Cluster] incr version session=%s failed: %v\n", sessionID, err)
+		return
+	}
+
+	//本实例的缓存就是修改后的状态，跟上新版本号；中间还有别的实例修改过时丢弃
+	m.mu.Lock()
+	if elem, exists := m.helpers[userName][sessionID]; exists {
+		entry := elem.Value.(*helperEntry)
+		if entry.version == version-1 {
+			entry.version = version
+		} else if !entry.busy() {
+			m.removeLocked(elem)
+		}
+	}
+	m.mu.Unlock()
+
+	publishInvalidation(invalidation{Instance: instanceID, UserName: userName, SessionID: sessionID})
+}
+
+// InvalidateUser 用户级的修改（人设、知识库）同步到本实例缓存后调用，通知其他实例丢弃该用户的所有会话
+func (m *AIHelperManager) InvalidateUser(userName string) {
+	if !clusterEnabled() {
+		return
+	}
+	publishInvalidation(invalidation{Instance: instanceID, UserName: userName})
+}
+
+// StopGeneration 停止生成：generationID不为空时只停止该次生成，否则停止会话上所有正在进行的生成
+// 多实例部署时生成可能运行在其他实例上，本实例没有找到（或按会话停止）时广播给其他实例，此时无法确定是否存在，按找到处理
+func StopGeneration(userName string, generationID string, sessionID string) bool {
+	found := cancelLocal(userName, generationID, sessionID)
+	if !clusterEnabled() || (found && generationID != "") {
+		return found
+	}
+	publishInvalidation(invalidation{Instance: instanceID, UserName: userName, SessionID: sessionID, Cancel: true, GenerationID: generationID})
+	return true
+}
+
+// 在本实例的生成任务中取消，返回是否找到
+func cancelLocal(userName string, generationID string, sessionID string) bool {
+	registry := GetGlobalGenerationRegistry()
+	if generationID != "" {
+		return registry.Cancel(userName, generationID) == nil
+	}
+	return registry.CancelSession(userName, sessionID) > 0
+}
+
+func publishInvalidation(msg invalidation) {
+	data, _ := json.Marshal(msg)
+	if err := redis.PublishSessionInvalidation(data); err != nil {
+		log.Println("[Cluster] publish invalidation failed:", err)
+	}
+}
+
+// 订阅其他实例的通知：缓存失效时丢弃对应的会话（正在使用的会话跳过，访问时会核对版本号），停止生成时取消本实例上的生成
+func (m *AIHelperManager) startInvalidationListener() {
+	if !clusterEnabled() {
+		return
+	}
+	redis.SubscribeSessionInvalidation(func(payload string) {
+		var msg invalidation
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.Instance == instanceID {
+			return
+		}
+		if msg.Cancel {
+			cancelLocal(msg.UserName, msg.GenerationID, msg.SessionID)
+			return
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for sessionID, elem := range m.helpers[msg.UserName] {
+			if msg.SessionID != "" && sessionID != msg.SessionID {
+				continue
+			}
+			if !elem.Value.(*helperEntry).busy() {
+				m.removeLocked(elem)
+			}
+		}
+	})
+}
+
+// 会话当前的版本号，未开启多实例部署或Redis异常时不核对
+func (m *AIHelperManager) currentVersion(sessionID string) (int64, bool) {
+	if m.versionFunc == nil {
+		return 0, false
+	}
+	version, err := m.versionFunc(sessionID)
+	if err != nil {
+		log.Printf("[Cluster] get version session=%s failed: %v\n", sessionID, err)
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,122 @@
+package aihelper
+
+//上下文窗口策略
+//1.用分词器估算每条消息占用的token数
+//2.在预算内尽可能多地保留最近的对话轮次，同时给模型回复预留空间
+//3.系统消息（人设、摘要等）始终保留
+import (
+	"GopherAI/config"
+	"unicode"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	defaultMaxContextTokens = 8192 //默认上下文窗口大小
+	defaultReserveTokens    = 1024 //默认给回复预留的token数
+	messageOverheadTokens   = 4    //每条消息的角色、分隔符等固定开销
+)
+
+// Tokenizer 分词器，用于统计文本占用的token数
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// EstimateTokenizer 近似分词器：中日韩字符按1个token计算，其余字符按4个字符1个token估算
+// 不依赖具体模型的词表，足够用于上下文预算的控制
+type EstimateTokenizer struct{}
+
+func (EstimateTokenizer) CountTokens(text string) int {
+	cjk, others := 0, 0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk++
+		} else {
+			others++
+		}
+	}
+	return cjk + (others+3)/4
+}
+
+// ContextStrategy 上下文策略：从完整历史中挑选本次请求发送给模型的消息
+type ContextStrategy interface {
+	//system为必须保留的系统消息，history为按时间顺序排列的对话历史
+	Build(system []*schema.Message, history []*schema.Message) []*schema.Message
+}
+
+// TokenBudgetStrategy 按token预算截取最近的对话
+type TokenBudgetStrategy struct {
+	Tokenizer        Tokenizer
+	MaxContextTokens int //模型上下文窗口大小
+	ReserveTokens    int //给模型回复预留的token数
+}
+
+// NewTokenBudgetStrategy 创建按token预算截取的策略，参数不大于0时使用默认值
+func NewTokenBudgetStrategy(tokenizer Tokenizer, maxContextTokens int, reserveTokens int) *TokenBudgetStrategy {
+	if tokenizer == nil {
+		tokenizer = EstimateTokenizer{}
+	}
+	if maxContextTokens <= 0 {
+		maxContextTokens = defaultMaxContextTokens
+	}
+	if reserveTokens <= 0 {
+		reserveTokens = defaultReserveTokens
+	}
+	return &TokenBudgetStrategy{
+		Tokenizer:        tokenizer,
+		MaxContextTokens: maxContextTokens,
+		ReserveTokens:    reserveTokens,
+	}
+}
+
+// NewDefaultContextStrategy 根据配置文件创建默认的上下文策略
+func NewDefaultContextStrategy() ContextStrategy {
+	conf := config.GetConfig().ContextConfig
+	return NewTokenBudgetStrategy(EstimateTokenizer{}, conf.MaxContextTokens, conf.ReserveTokens)
+}
+
+// CountMessage 统计一条消息占用的token数
+func (s *TokenBudgetStrategy) CountMessage(msg *schema.Message) int {
+	n := messageOverheadTokens + s.Tokenizer.CountTokens(msg.Content)
+	for _, call := range msg.ToolCalls {
+		n += s.Tokenizer.CountTokens(call.Function.Name) + s.Tokenizer.CountTokens(call.Function.Arguments)
+	}
+	return n
+}
+
+func (s *TokenBudgetStrategy) Build(system []*schema.Message, history []*schema.Message) []*schema.Message {
+	budget := s.MaxContextTokens - s.ReserveTokens
+	for _, msg := range system {
+		budget -= s.CountMessage(msg)
+	}
+
+	//当前这一轮（最后一条用户消息及之后的工具调用）无论如何都要完整保留
+	start := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		budget -= s.CountMessage(history[i])
+		start = i
+		if history[i].Role == schema.User {
+			break
+		}
+	}
+
+	//再从新到旧按整轮追加更早的对话，直到预算用完，避免出现孤立的助手回复或工具结果
+	for start > 0 {
+		turnStart := start - 1
+		cost := s.CountMessage(history[turnStart])
+		for turnStart > 0 && history[turnStart].Role != schema.User {
+			turnStart--
+			cost += s.CountMessage(history[turnStart])
+		}
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		start = turnStart
+	}
+
+	out := make([]*schema.Message, 0, len(system)+len(history)-start)
+	out = append(out, system...)
+	out = append(out, history[start:]...)
+	return out
+}
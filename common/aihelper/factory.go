@@ -4,8 +4,10 @@ package aihelper
 //屏蔽具体模型构造细节
 //提供全局单例工厂，便于统一注册和调用
 import (
+	"GopherAI/config"
 	"context"
 	"fmt"
+	"log"
 	"sync"
 )
 
@@ -16,6 +18,18 @@ type ModelCreator func(ctx context.Context, config map[string]interface{}) (AIMo
 type AIModelFactory struct {
 	creators map[string]ModelCreator
 	//用于保存不同模型类型的创建函数
+	contextStrategies map[string]ContextStrategy
+	//不同模型类型的上下文策略，未注册的使用默认策略
+	models []ModelInfo
+	//可供前端选择的模型列表
+}
+
+// ModelInfo 模型的展示信息
+type ModelInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Vision   bool   `json:"vision"` //是否支持图片输入
 }
 
 var (
@@ -27,29 +41,103 @@ var (
 func GetGlobalFactory() *AIModelFactory {
 	factoryOnce.Do(func() {
 		globalFactory = &AIModelFactory{
-			creators: make(map[string]ModelCreator),
+			creators:          make(map[string]ModelCreator),
+			contextStrategies: make(map[string]ContextStrategy),
 		}
 		globalFactory.registerCreators() //注册内置模型创建器
 	})
 	return globalFactory
 }
 
-// 注册模型
+// 根据配置文件中的[[models]]注册模型，模型类型即配置中的id
 func (f *AIModelFactory) registerCreators() {
-	//OpenAI
-	f.creators["1"] = func(ctx context.Context, config map[string]interface{}) (AIModel, error) {
-		return NewOpenAIModel(ctx)
+	conf := config.GetConfig()
+	cyclic := failoverCycles(conf.Models)
+	for i := range conf.Models {
+		mc := &conf.Models[i]
+		switch mc.Provider {
+		case "openai":
+			f.creators[mc.ID] = func(ctx context.Context, config map[string]interface{}) (AIModel, error) {
+				return NewOpenAIModel(ctx, mc)
+			}
+		case "ollama":
+			f.creators[mc.ID] = func(ctx context.Context, config map[string]interface{}) (AIModel, error) {
+				return NewOllamaModel(ctx, mc)
+			}
+		case "failover":
+			if cyclic[mc.ID] {
+				//互为备用的故障转移模型创建时会无限递归
+				log.Printf("[AIModelFactory] failover %s: fallbacks form a cycle, skipped\n", mc.ID)
+				continue
+			}
+			f.creators[mc.ID] = func(ctx context.Context, config map[string]interface{}) (AIModel, error) {
+				backends := make([]AIModel, 0, len(mc.Fallbacks))
+				for _, id := range mc.Fallbacks {
+					if id == mc.ID {
+						continue
+					}
+					backend, err := f.CreateAIModel(ctx, id, config)
+					if err != nil {
+						log.Printf("[AIModelFactory] failover %s: create backend %s failed: %v\n", mc.ID, id, err)
+						continue
+					}
+					backends = append(backends, backend)
+				}
+				return NewFailoverModel(mc.ID, backends)
+			}
+		default:
+			log.Printf("[AIModelFactory] model %s has unsupported provider %s, skipped\n", mc.ID, mc.Provider)
+			continue
+		}
+		f.models = append(f.models, ModelInfo{ID: mc.ID, Name: mc.Name, Provider: mc.Provider, Vision: mc.Vision})
+
+		//模型单独配置了上下文窗口时，使用对应大小的上下文策略
+		if mc.MaxContextTokens > 0 {
+			f.contextStrategies[mc.ID] = NewTokenBudgetStrategy(EstimateTokenizer{}, mc.MaxContextTokens, conf.ReserveTokens)
+		}
 	}
+}
 
-	//Ollama
-	f.creators["2"] = func(ctx context.Context, config map[string]interface{}) (AIModel, error) {
-		baseURL, _ := config["baseURL"].(string)
-		modelName, ok := config["modelName"].(string)
-		if !ok {
-			return nil, fmt.Errorf("Ollama model requires modelName")
+// 找出备用模型列表成环的故障转移模型（A→B→A），不包括只指向自身的情况（创建时会跳过自身）
+func failoverCycles(models []config.ModelConfig) map[string]bool {
+	fallbacks := make(map[string][]string)
+	for _, mc := range models {
+		if mc.Provider == "failover" {
+			fallbacks[mc.ID] = mc.Fallbacks
 		}
-		return NewOllamaModel(ctx, baseURL, modelName)
 	}
+
+	cyclic := make(map[string]bool)
+	for id := range fallbacks {
+		//从id出发沿备用模型遍历，能回到id说明在环上
+		visited := make(map[string]bool)
+		stack := []string{id}
+		for len(stack) > 0 && !cyclic[id] {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, next := range fallbacks[cur] {
+				if next == cur {
+					continue
+				}
+				if next == id {
+					cyclic[id] = true
+					break
+				}
+				if !visited[next] {
+					visited[next] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+	}
+	return cyclic
+}
+
+// ListModels 获取所有可用模型（按配置顺序，第一个为默认模型）
+func (f *AIModelFactory) ListModels() []ModelInfo {
+	out := make([]ModelInfo, len(f.models))
+	copy(out, f.models)
+	return out
 }
 
 // CreateAIModel 根据类型创建 AI 模型
@@ -67,10 +155,33 @@ func (f *AIModelFactory) CreateAIHelper(ctx context.Context, modelType string, S
 	if err != nil {
 		return nil, err
 	}
-	return NewAIHelper(model, SessionID), nil
+	helper := NewAIHelper(model, SessionID)
+	if strategy, ok := f.contextStrategies[modelType]; ok {
+		helper.SetContextStrategy(strategy)
+	}
+	return helper, nil
+}
+
+// SwitchModel 把会话切换到另一个模型，上下文策略随模型一起切换
+func (f *AIModelFactory) SwitchModel(ctx context.Context, helper *AIHelper, modelType string, config map[string]interface{}) error {
+	model, err := f.CreateAIModel(ctx, modelType, config)
+	if err != nil {
+		return err
+	}
+	strategy, ok := f.contextStrategies[modelType]
+	if !ok {
+		strategy = NewDefaultContextStrategy()
+	}
+	helper.setModel(model, strategy)
+	return nil
 }
 
 // RegisterModel 可扩展注册
 func (f *AIModelFactory) RegisterModel(modelType string, creator ModelCreator) {
 	f.creators[modelType] = creator
 }
+
+// RegisterContextStrategy 为指定模型类型注册上下文策略
+func (f *AIModelFactory) RegisterContextStrategy(modelType string, strategy ContextStrategy) {
+	f.contextStrategies[modelType] = strategy
+}
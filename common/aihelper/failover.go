@@ -0,0 +1,254 @@
+package aihelper
+
+//多模型故障转移
+//1.按顺序尝试多个后端模型，前一个失败时自动切换到下一个
+//2.对限流、5xx、超时等可重试错误做指数退避重试
+//3.每个后端一个熔断器，连续出现可重试错误过多时暂时跳过该后端
+//4.流式输出一旦向前端推送过内容，就不再切换后端，避免前端收到两段拼接的回答
+import (
+	"GopherAI/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// BackendExtraKey 回复消息Extra中记录实际作答后端的key
+const BackendExtraKey = "gopherai_backend"
+
+const (
+	defaultMaxRetries       = 2
+	defaultInitialBackoff   = 500 * time.Millisecond
+	defaultMaxBackoff       = 5 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// 错误信息中的HTTP状态码，例如 "status code: 429"
+var statusCodeRe = regexp.MustCompile(`status code: (\d{3})`)
+
+// ErrAllBackendsFailed 所有后端都不可用
+var ErrAllBackendsFailed = errors.New("all model backends failed")
+
+// =================== 熔断器 ===================
+
+// 熔断器：连续失败次数达到阈值后打开，冷却期内直接跳过；冷却结束后放行请求试探（半开），成功则关闭
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	threshold int
+	cooldown  time.Duration
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		//失败计数不清零，半开状态下再失败一次会立刻重新熔断
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+var (
+	breakers   = make(map[string]*circuitBreaker) //按后端模型id共享，多个故障转移模型引用同一后端时共用熔断状态
+	breakersMu sync.Mutex
+)
+
+func getBreaker(backendID string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[backendID]
+	if !ok {
+		conf := config.GetConfig().FailoverConfig
+		b = &circuitBreaker{
+			threshold: conf.BreakerThreshold,
+			cooldown:  time.Duration(conf.BreakerCooldownSeconds) * time.Second,
+		}
+		if b.threshold <= 0 {
+			b.threshold = defaultBreakerThreshold
+		}
+		if b.cooldown <= 0 {
+			b.cooldown = defaultBreakerCooldown
+		}
+		breakers[backendID] = b
+	}
+	return b
+}
+
+// =================== 故障转移模型 ===================
+
+// FailoverModel 组合多个后端的模型，对上层表现为一个普通的AIModel
+type FailoverModel struct {
+	id             string
+	backends       []AIModel //按优先级排列
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func NewFailoverModel(id string, backends []AIModel) (*FailoverModel, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("failover model %s requires at least one backend", id)
+	}
+	conf := config.GetConfig().FailoverConfig
+	f := &FailoverModel{
+		id:             id,
+		backends:       backends,
+		maxRetries:     conf.MaxRetries,
+		initialBackoff: time.Duration(conf.InitialBackoffMs) * time.Millisecond,
+		maxBackoff:     time.Duration(conf.MaxBackoffMs) * time.Millisecond,
+	}
+	if f.maxRetries < 0 {
+		f.maxRetries = 0
+	} else if f.maxRetries == 0 {
+		f.maxRetries = defaultMaxRetries
+	}
+	if f.initialBackoff <= 0 {
+		f.initialBackoff = defaultInitialBackoff
+	}
+	if f.maxBackoff <= 0 {
+		f.maxBackoff = defaultMaxBackoff
+	}
+	return f, nil
+}
+
+// 判断错误是否值得重试：限流（429）、服务端错误（5xx）、超时和连接异常
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	if m := statusCodeRe.FindStringSubmatch(msg); m != nil {
+		status, _ := strconv.Atoi(m[1])
+		return status == 429 || status >= 500
+	}
+	return strings.Contains(msg, "timeout") ||
+		strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "unexpected eof")
+}
+
+// 第attempt次重试前的等待时间（指数退避，有上限）
+func (f *FailoverModel) backoff(attempt int) time.Duration {
+	d := f.initialBackoff << attempt
+	if d <= 0 || d > f.maxBackoff {
+		d = f.maxBackoff
+	}
+	return d
+}
+
+// 依次在各个后端上执行call，返回第一个成功的结果
+// call返回stop=true时表示不能再重试或切换（例如流式输出已经推送过内容）
+func (f *FailoverModel) run(ctx context.Context, call func(backend AIModel) (*schema.Message, bool, error)) (*schema.Message, error) {
+	var lastErr error
+	for _, backend := range f.backends {
+		backendID := backend.GetModelType()
+		breaker := getBreaker(backendID)
+		if !breaker.allow() {
+			log.Printf("[FailoverModel] %s: backend %s circuit open, skipped\n", f.id, backendID)
+			continue
+		}
+
+		for attempt := 0; attempt <= f.maxRetries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(f.backoff(attempt - 1)):
+				}
+			}
+
+			resp, stop, err := call(backend)
+			if err == nil {
+				breaker.success()
+				if resp.Extra == nil {
+					resp.Extra = make(map[string]any)
+				}
+				//记录实际作答的后端；备用模型本身也是故障转移模型时，保留它记录的内层后端
+				if _, ok := resp.Extra[BackendExtraKey]; !ok {
+					resp.Extra[BackendExtraKey] = backendID
+				}
+				return resp, nil
+			}
+
+			lastErr = err
+			if errors.Is(err, context.Canceled) || stop {
+				return nil, err
+			}
+			log.Printf("[FailoverModel] %s: backend %s attempt %d failed: %v\n", f.id, backendID, attempt+1, err)
+			if !isRetryable(err) {
+				//参数错误、鉴权失败、内容审核等是请求本身的问题，不计入熔断（熔断器全局共享，避免个别请求拖垮后端），直接切换下一个后端
+				break
+			}
+			breaker.failure()
+			if !breaker.allow() {
+				break //已熔断，直接切换下一个后端
+			}
+		}
+	}
+
+	if lastErr == nil {
+		return nil, ErrAllBackendsFailed
+	}
+	return nil, fmt.Errorf("%w: %w", ErrAllBackendsFailed, lastErr)
+}
+
+func (f *FailoverModel) GenerateResponse(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return f.run(ctx, func(backend AIModel) (*schema.Message, bool, error) {
+		resp, err := backend.GenerateResponse(ctx, messages, opts...)
+		return resp, false, err
+	})
+}
+
+func (f *FailoverModel) StreamResponse(ctx context.Context, messages []*schema.Message, cb StreamCallback, opts ...model.Option) (*schema.Message, error) {
+	return f.run(ctx, func(backend AIModel) (*schema.Message, bool, error) {
+		started := false
+		resp, err := backend.StreamResponse(ctx, messages, func(msg string) {
+			started = true
+			cb(msg)
+		}, opts...)
+		return resp, started, err
+	})
+}
+
+func (f *FailoverModel) GetModelType() string { return f.id }
+
+// AnsweredBy 获取回复实际由哪个后端生成（普通模型即自身）
+func AnsweredBy(msg *schema.Message, m AIModel) string {
+	if backend, ok := msg.Extra[BackendExtraKey].(string); ok {
+		return backend
+	}
+	return m.GetModelType()
+}
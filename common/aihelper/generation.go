@@ -0,0 +1,108 @@
+package aihelper
+
+//生成任务注册中心
+//每次生成都运行在一个可取消的context上，并以生成id登记
+//停止接口通过生成id（或会话id）找到对应的任务并取消
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrGenerationNotFound 生成任务不存在（已经结束或不属于该用户）
+var ErrGenerationNotFound = errors.New("generation not found")
+
+// Generation 一次正在进行的生成
+type Generation struct {
+	ID        string
+	UserName  string
+	SessionID string
+	Ctx       context.Context //模型调用使用的context，被取消时生成随之停止
+	cancel    context.CancelFunc
+}
+
+// GenerationRegistry 正在进行的生成任务
+type GenerationRegistry struct {
+	generations map[string]*Generation //map[生成id]*Generation
+	mu          sync.Mutex
+}
+
+var (
+	globalGenerationRegistry *GenerationRegistry
+	generationRegistryOnce   sync.Once
+)
+
+// GetGlobalGenerationRegistry 获取全局生成任务注册中心
+func GetGlobalGenerationRegistry() *GenerationRegistry {
+	generationRegistryOnce.Do(func() {
+		globalGenerationRegistry = &GenerationRegistry{
+			generations: make(map[string]*Generation),
+		}
+	})
+	return globalGenerationRegistry
+}
+
+// Start 登记一次新的生成，parent一般为HTTP请求的context，客户端断开时生成同样会被取消
+// 生成结束后必须调用Finish释放
+func (r *GenerationRegistry) Start(parent context.Context, userName string, sessionID string) *Generation {
+	genCtx, cancel := context.WithCancel(parent)
+	g := &Generation{
+		ID:        uuid.New().String(),
+		UserName:  userName,
+		SessionID: sessionID,
+		Ctx:       genCtx,
+		cancel:    cancel,
+	}
+	r.mu.Lock()
+	r.generations[g.ID] = g
+	r.mu.Unlock()
+	return g
+}
+
+// Finish 生成结束，移除登记并释放context
+func (r *GenerationRegistry) Finish(g *Generation) {
+	r.mu.Lock()
+	delete(r.generations, g.ID)
+	r.mu.Unlock()
+	g.cancel()
+}
+
+// Cancel 按生成id取消（只能取消自己的生成）
+func (r *GenerationRegistry) Cancel(userName string, generationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.generations[generationID]
+	if !ok || g.UserName != userName {
+		return ErrGenerationNotFound
+	}
+	g.cancel()
+	return nil
+}
+
+// CancelSession 取消某个会话上所有正在进行的生成，返回取消的个数
+func (r *GenerationRegistry) CancelSession(userName string, sessionID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, g := range r.generations {
+		if g.UserName == userName && g.SessionID == sessionID {
+			g.cancel()
+			n++
+		}
+	}
+	return n
+}
+
+// Active 会话上是否有正在进行的生成
+func (r *GenerationRegistry) Active(userName string, sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range r.generations {
+		if g.UserName == userName && g.SessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package aihelper
+
+//知识库检索增强
+//会话挂载知识库后，每轮对话先用用户的问题检索相关资料，作为带编号的系统消息放进上下文，
+//要求模型用[n]标注引用，引用的资料随回答一起保存
+import (
+	"GopherAI/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Retriever 知识库检索器
+type Retriever interface {
+	Retrieve(ctx context.Context, knowledgeBaseIDs []uint, query string) ([]model.Source, error)
+}
+
+// SetRetriever 替换知识库检索器
+func (a *AIHelper) SetRetriever(retriever Retriever) {
+	a.retriever = retriever
+}
+
+// SetKnowledgeBases 设置会话挂载的知识库，为空表示不检索
+func (a *AIHelper) SetKnowledgeBases(ids []uint) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.knowledgeBaseIDs = append([]uint(nil), ids...)
+}
+
+// GetKnowledgeBases 获取会话挂载的知识库
+func (a *AIHelper) GetKnowledgeBases() []uint {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]uint(nil), a.knowledgeBaseIDs...)
+}
+
+// 用当前分支最后一个用户问题检索资料，检索失败时不影响正常回答
+func (a *AIHelper) retrieve(ctx context.Context) []model.Source {
+	a.mu.RLock()
+	ids := append([]uint(nil), a.knowledgeBaseIDs...)
+	var query string
+	path := a.activePath()
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].IsUser {
+			query = path[i].Content
+			break
+		}
+	}
+	a.mu.RUnlock()
+
+	if len(ids) == 0 || query == "" || a.retriever == nil {
+		return nil
+	}
+	sources, err := a.retriever.Retrieve(ctx, ids, query)
+	if err != nil {
+		log.Printf("[AIHelper] session=%s retrieve failed: %v\n", a.SessionID, err)
+		return nil
+	}
+	return sources
+}
+
+// 把检索到的资料拼成系统消息
+func sourcesMessage(sources []model.Source) *schema.Message {
+	var b strings.Builder
+	b.WriteString("以下是从用户知识库中检索到的资料，请优先依据这些资料回答，并在引用处用[编号]标注来源（如[1]）；资料与问题无关时忽略即可，不要编造引用。\n")
+	for _, s := range sources {
+		fmt.Fprintf(&b, "\n[%d] 来自《%s》：\n%s\n", s.Index, s.FileName, s.Content)
+	}
+	return schema.SystemMessage(b.String())
+}
+
+// 把引用资料编码后记录到回复消息上
+func attachSources(msg *model.Message, sources []model.Source) {
+	if len(sources) == 0 {
+		return
+	}
+	data, err := json.Marshal(sources)
+	if err != nil {
+		log.Println("attachSources marshal error:", err)
+		return
+	}
+	msg.Sources = string(data)
+}
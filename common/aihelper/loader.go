@@ -0,0 +1,78 @@
+package aihelper
+
+//从数据库恢复会话：模型、生成参数、标题状态、摘要、人设、消息树、所在分支和挂载的知识库
+import (
+	"GopherAI/config"
+	"GopherAI/dao/knowledge"
+	"GopherAI/dao/message"
+	"GopherAI/dao/persona"
+	"GopherAI/dao/session"
+	"errors"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// ErrSessionNotFound 会话不存在或不属于该用户
+var ErrSessionNotFound = errors.New("session not found")
+
+// LoadAIHelper 从数据库加载会话并创建AIHelper
+// 会话按创建时记录的模型恢复；升级前没有记录模型的会话使用modelType（为空时用默认模型），并补记到数据库
+func LoadAIHelper(userName string, sessionID string, modelType string) (*AIHelper, error) {
+	sess, err := session.GetUserSessionByID(userName, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	conf := config.GetConfig()
+	if sess.ModelType != "" {
+		modelType = sess.ModelType
+	}
+	if _, ok := conf.GetModelConfig(modelType); !ok {
+		//记录的模型已从配置中移除时退回默认模型
+		modelType = conf.DefaultModelType()
+	}
+	helper, err := GetGlobalFactory().CreateAIHelper(ctx, modelType, sessionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if sess.ModelType == "" {
+		if err := session.UpdateSessionModelType(sessionID, modelType); err != nil {
+			log.Println("LoadAIHelper UpdateSessionModelType error:", err)
+		}
+	}
+
+	helper.SetSummary(sess.Summary, sess.SummarizedUntil)
+	helper.SetTitled(sess.TitleGenerated)
+	helper.SetParams(GenerationParams{Temperature: sess.Temperature, TopP: sess.TopP, MaxTokens: sess.MaxTokens})
+	if sess.PersonaID != 0 {
+		if p, err := persona.GetPersonaByID(userName, sess.PersonaID); err == nil {
+			helper.SetPersona(p.ID, p.SystemPrompt, p.Temperature)
+		}
+	}
+
+	msgs, err := message.GetMessagesBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range msgs {
+		// 添加消息到内存中(不开启存储功能)，保留工具调用、父消息等字段
+		helper.LoadMessage(&msgs[i])
+	}
+	if sess.ActiveLeafID != "" {
+		helper.SetActiveLeaf(sess.ActiveLeafID)
+	}
+
+	kbIDs, err := knowledge.GetSessionKnowledgeBaseIDs(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	helper.SetKnowledgeBases(kbIDs)
+
+	//会话会被淘汰后从数据库重新加载（多实例部署时其他实例也会加载），消息同步写入数据库，保证重新加载时不丢消息
+	helper.SetSaveFunc(message.CreateMessage)
+	return helper, nil
+}
@@ -2,93 +2,225 @@ package aihelper //AI会话管理层
 
 //1.维护：用户->对话->AIHelper的映射关系
 //2.提供线程安全的创建/获取/移除能力
-//3.统一管理AIHelper的生命周期
+//3.统一管理AIHelper的生命周期：首次访问时从数据库加载，空闲或超出容量时淘汰
+//4.多实例部署时按Redis中的会话版本号核对缓存（见cluster.go）
 import (
+	"GopherAI/common/redis"
+	"GopherAI/config"
+	"container/list"
 	"context"
+	"log"
 	"sync"
+	"time"
 )
 
 // 全局上下文
 var ctx = context.Background()
 
+// 内存中的一个会话
+type helperEntry struct {
+	userName   string
+	sessionID  string
+	helper     *AIHelper
+	lastAccess time.Time
+	version    int64 //加载时会话的版本号
+}
+
 // AIHelperManager AI助手管理器，管理用户-会话-AIHelper的映射关系
 type AIHelperManager struct {
-	helpers map[string]map[string]*AIHelper // map[用户账号（唯一）]map[会话ID]*AIHelper
-	mu      sync.RWMutex
+	helpers map[string]map[string]*list.Element // map[用户账号（唯一）]map[会话ID]*list.Element(*helperEntry)
+	lru     *list.List                          //按最近访问排序，队头为最近使用
+	mu      sync.Mutex
+
+	maxHelpers int           //容量上限，0表示不限制
+	idleTTL    time.Duration //空闲淘汰时间，0表示不按时间淘汰
+	//从数据库加载会话（通过回调函数方便替换存储实现）
+	loadFunc func(userName string, sessionID string, modelType string) (*AIHelper, error)
+	//获取会话当前的版本号，为nil时不核对（单实例部署）
+	versionFunc func(sessionID string) (int64, error)
 }
 
 // NewAIHelperManager 创建新的管理器实例
 func NewAIHelperManager() *AIHelperManager {
-	return &AIHelperManager{
-		helpers: make(map[string]map[string]*AIHelper),
+	conf := config.GetConfig().SessionCacheConfig
+	m := &AIHelperManager{
+		helpers:    make(map[string]map[string]*list.Element),
+		lru:        list.New(),
+		maxHelpers: conf.MaxHelpers,
+		idleTTL:    time.Duration(conf.IdleMinutes) * time.Minute,
+		loadFunc:   LoadAIHelper,
 	}
+	if clusterEnabled() {
+		m.versionFunc = redis.GetSessionVersion
+	}
+	return m
 }
 
-// 获取或创建AIHelper
+// 获取或创建AIHelper：不在内存中时从数据库加载，modelType只在会话没有记录模型时使用
+// 会话不存在（或不属于该用户）时返回ErrSessionNotFound
 func (m *AIHelperManager) GetOrCreateAIHelper(userName string, sessionID string, modelType string, config map[string]interface{}) (*AIHelper, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// 获取用户的会话映射
-	userHelpers, exists := m.helpers[userName]
-	if !exists {
-		userHelpers = make(map[string]*AIHelper)
-		m.helpers[userName] = userHelpers
-	}
-
-	// 检查会话是否已存在
-	helper, exists := userHelpers[sessionID]
-	if exists {
+	// 先取版本号再加载，加载期间会话被修改时下次访问会重新加载
+	version, checkVersion := m.currentVersion(sessionID)
+	if helper, ok := m.lookup(userName, sessionID, version, checkVersion); ok {
 		return helper, nil
 	}
 
-	// 创建新的AIHelper
-	factory := GetGlobalFactory()
-	helper, err := factory.CreateAIHelper(ctx, modelType, sessionID, config)
+	// 在锁外加载，避免一个会话的数据库查询阻塞其他会话
+	helper, err := m.loadFunc(userName, sessionID, modelType)
 	if err != nil {
 		return nil, err
 	}
-
-	userHelpers[sessionID] = helper
-	return helper, nil
+	return m.store(userName, sessionID, helper, version), nil
 }
 
-// 获取指定用户的指定会话的AIHelper
+// 获取指定用户的指定会话的AIHelper，不在内存中时从数据库加载
 func (m *AIHelperManager) GetAIHelper(userName string, sessionID string) (*AIHelper, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	helper, err := m.GetOrCreateAIHelper(userName, sessionID, "", nil)
+	if err != nil {
+		if err != ErrSessionNotFound {
+			log.Printf("[AIHelperManager] load session=%s failed: %v\n", sessionID, err)
+		}
+		return nil, false
+	}
+	return helper, true
+}
 
-	userHelpers, exists := m.helpers[userName]
+// CachedAIHelper 只在内存中查找，不从数据库加载
+func (m *AIHelperManager) CachedAIHelper(userName string, sessionID string) (*AIHelper, bool) {
+	return m.lookup(userName, sessionID, 0, false)
+}
+
+// 只在内存中查找，命中时刷新访问时间；checkVersion为true时版本号不一致的缓存视为未命中（正在使用的除外）
+func (m *AIHelperManager) lookup(userName string, sessionID string, version int64, checkVersion bool) (*AIHelper, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, exists := m.helpers[userName][sessionID]
 	if !exists {
 		return nil, false
 	}
-
-	helper, exists := userHelpers[sessionID]
-	return helper, exists
+	entry := elem.Value.(*helperEntry)
+	if checkVersion && entry.version != version && !entry.busy() {
+		m.removeLocked(elem) //其他实例修改过，丢弃后重新加载
+		return nil, false
+	}
+	entry.lastAccess = time.Now()
+	m.lru.MoveToFront(elem)
+	return entry.helper, true
 }
 
-// 移除指定用户的指定会话的AIHelper
-func (m *AIHelperManager) RemoveAIHelper(userName string, sessionID string) {
+// 放入内存，并发加载同一个会话时以先放入的为准；超出容量时淘汰最久未使用的会话
+func (m *AIHelperManager) store(userName string, sessionID string, helper *AIHelper, version int64) *AIHelper {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	userHelpers, exists := m.helpers[userName]
 	if !exists {
-		return
+		userHelpers = make(map[string]*list.Element)
+		m.helpers[userName] = userHelpers
+	}
+	if elem, exists := userHelpers[sessionID]; exists {
+		m.lru.MoveToFront(elem)
+		return elem.Value.(*helperEntry).helper
 	}
 
-	delete(userHelpers, sessionID)
+	userHelpers[sessionID] = m.lru.PushFront(&helperEntry{
+		userName:   userName,
+		sessionID:  sessionID,
+		helper:     helper,
+		lastAccess: time.Now(),
+		version:    version,
+	})
+
+	if m.maxHelpers > 0 {
+		// 从队尾开始淘汰，正在生成的会话跳过
+		for elem := m.lru.Back(); elem != nil && m.lru.Len() > m.maxHelpers; {
+			prev := elem.Prev()
+			if entry := elem.Value.(*helperEntry); !entry.busy() {
+				m.removeLocked(elem)
+			}
+			elem = prev
+		}
+	}
+	return helper
+}
+
+// 会话是否还有任务在使用，正在使用的会话不淘汰，避免内存状态和数据库不一致
+func (e *helperEntry) busy() bool {
+	return e.helper.summarizing.Load() || GetGlobalGenerationRegistry().Active(e.userName, e.sessionID)
+}
+
+// 从内存中移除（调用方需持有锁）
+func (m *AIHelperManager) removeLocked(elem *list.Element) {
+	entry := m.lru.Remove(elem).(*helperEntry)
+	userHelpers := m.helpers[entry.userName]
+	delete(userHelpers, entry.sessionID)
 
 	// 如果用户没有会话了，清理用户映射
 	if len(userHelpers) == 0 {
-		delete(m.helpers, userName)
+		delete(m.helpers, entry.userName)
+	}
+}
+
+// 移除指定用户的指定会话的AIHelper
+func (m *AIHelperManager) RemoveAIHelper(userName string, sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, exists := m.helpers[userName][sessionID]; exists {
+		m.removeLocked(elem)
 	}
 }
 
-// 获取指定用户的所有会话ID
+// 淘汰空闲超过idleTTL的会话，返回淘汰的个数
+func (m *AIHelperManager) EvictIdle() int {
+	if m.idleTTL <= 0 {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deadline := time.Now().Add(-m.idleTTL)
+	n := 0
+	for elem := m.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		entry := elem.Value.(*helperEntry)
+		if entry.lastAccess.After(deadline) {
+			break //队列按访问时间排序，后面的都更新
+		}
+		if !entry.busy() {
+			m.removeLocked(elem)
+			n++
+		}
+		elem = prev
+	}
+	return n
+}
+
+// 后台定时淘汰空闲会话
+func (m *AIHelperManager) startJanitor() {
+	if m.idleTTL <= 0 {
+		return
+	}
+	interval := m.idleTTL / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n := m.EvictIdle(); n > 0 {
+				log.Printf("[AIHelperManager] evicted %d idle sessions\n", n)
+			}
+		}
+	}()
+}
+
+// 获取指定用户当前在内存中的会话ID（不触发加载，用于同步修改到已加载的会话）
 func (m *AIHelperManager) GetUserSessions(userName string) []string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	userHelpers, exists := m.helpers[userName]
 	if !exists {
@@ -112,6 +244,8 @@ var once sync.Once
 func GetGlobalManager() *AIHelperManager {
 	once.Do(func() {
 		globalManager = NewAIHelperManager()
+		globalManager.startJanitor()
+		globalManager.startInvalidationListener()
 	})
 	return globalManager
 }
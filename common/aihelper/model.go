@@ -4,11 +4,11 @@ package aihelper
 //通过接口抽象，屏蔽OpenAI/Ollama等模型差异
 
 import (
+	"GopherAI/config"
 	"context"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
 	//eino提供的大模型扩展组件
 	"github.com/cloudwego/eino-ext/components/model/ollama"
@@ -24,42 +24,68 @@ import (
 // 流式输出的回调函数类型
 type StreamCallback func(msg string)
 
+// 会话流式生成的回调，messageID为正在生成的回复消息的ID（开始生成前分配，和最终保存的消息一致）
+type ReplyCallback func(messageID string, msg string)
+
 // AIModel 定义AI模型接口(上层业务只依赖AIModel，底层可以自由切换OpenAI/Ollama/其他模型)
+// opts用于透传调用参数，例如通过model.WithTools绑定工具
 type AIModel interface {
 	//一次性生成完整回复（非流式调用）
-	GenerateResponse(ctx context.Context, messages []*schema.Message) (*schema.Message, error)
-	//逐步生成回复内容，并通过回调实时返回（流式调用）
-	StreamResponse(ctx context.Context, messages []*schema.Message, cb StreamCallback) (string, error)
-	//返回模型类型标识
+	GenerateResponse(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error)
+	//逐步生成回复内容，并通过回调实时返回（流式调用），返回聚合后的完整消息（可能包含ToolCalls）
+	StreamResponse(ctx context.Context, messages []*schema.Message, cb StreamCallback, opts ...model.Option) (*schema.Message, error)
+	//返回模型类型标识（配置中的模型id）
 	GetModelType() string
 }
 
+// 把配置中的默认生成参数转换成调用参数，调用时再追加的参数会覆盖这里的默认值
+func defaultOptions(conf *config.ModelConfig) []model.Option {
+	var opts []model.Option
+	if conf.Temperature != nil {
+		opts = append(opts, model.WithTemperature(*conf.Temperature))
+	}
+	if conf.TopP != nil {
+		opts = append(opts, model.WithTopP(*conf.TopP))
+	}
+	if conf.MaxTokens > 0 {
+		opts = append(opts, model.WithMaxTokens(conf.MaxTokens))
+	}
+	return opts
+}
+
+// 合并默认参数和本次调用的参数（复制一份，避免多个请求共用底层数组）
+func mergeOptions(defaults []model.Option, opts []model.Option) []model.Option {
+	merged := make([]model.Option, 0, len(defaults)+len(opts))
+	merged = append(merged, defaults...)
+	return append(merged, opts...)
+}
+
 // =================== OpenAI 实现 ===================
 type OpenAIModel struct {
-	llm model.ToolCallingChatModel //是eino对ChatCompletion的统一抽象
+	llm      model.ToolCallingChatModel //是eino对ChatCompletion的统一抽象
+	id       string                     //配置中的模型标识
+	defaults []model.Option             //配置中的默认生成参数
 }
 
-func NewOpenAIModel(ctx context.Context) (*OpenAIModel, error) {
-	key := os.Getenv("OPENAI_API_KEY")
-	modelName := os.Getenv("OPENAI_MODEL_NAME")
-	baseURL := os.Getenv("OPENAI_BASE_URL")
+func NewOpenAIModel(ctx context.Context, conf *config.ModelConfig) (*OpenAIModel, error) {
+	key := os.Getenv(conf.APIKeyEnv)
 
 	//创建OpenAI ChatModel实例
 	llm, err := openai.NewChatModel(ctx, &openai.ChatModelConfig{
-		BaseURL: baseURL,
-		Model:   modelName,
+		BaseURL: conf.BaseURL,
+		Model:   conf.ModelName,
 		APIKey:  key,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("create openai model failed: %v", err)
+		return nil, fmt.Errorf("create openai model failed: %w", err)
 	}
-	return &OpenAIModel{llm: llm}, nil
+	return &OpenAIModel{llm: llm, id: conf.ID, defaults: defaultOptions(conf)}, nil
 }
 
-func (o *OpenAIModel) GenerateResponse(ctx context.Context, messages []*schema.Message) (*schema.Message, error) {
-	resp, err := o.llm.Generate(ctx, messages)
+func (o *OpenAIModel) GenerateResponse(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	resp, err := o.llm.Generate(ctx, messages, mergeOptions(o.defaults, opts)...)
 	if err != nil {
-		return nil, fmt.Errorf("openai generate failed: %v", err)
+		return nil, fmt.Errorf("openai generate failed: %w", err)
 	}
 	return resp, nil
 }
@@ -69,14 +95,14 @@ func (o *OpenAIModel) GenerateResponse(ctx context.Context, messages []*schema.M
 // 2.不断Recv()接收模型返回的delta
 // 3.每收到一段就调用cb推送
 // 4.同时在本地聚合完整结果
-func (o *OpenAIModel) StreamResponse(ctx context.Context, messages []*schema.Message, cb StreamCallback) (string, error) {
-	stream, err := o.llm.Stream(ctx, messages)
+func (o *OpenAIModel) StreamResponse(ctx context.Context, messages []*schema.Message, cb StreamCallback, opts ...model.Option) (*schema.Message, error) {
+	stream, err := o.llm.Stream(ctx, messages, mergeOptions(o.defaults, opts)...)
 	if err != nil {
-		return "", fmt.Errorf("openai stream failed: %v", err)
+		return nil, fmt.Errorf("openai stream failed: %w", err)
 	}
 	defer stream.Close()
 
-	var fullResp strings.Builder
+	var chunks []*schema.Message
 
 	for {
 		msg, err := stream.Recv()
@@ -84,67 +110,80 @@ func (o *OpenAIModel) StreamResponse(ctx context.Context, messages []*schema.Mes
 			break
 		}
 		if err != nil {
-			return "", fmt.Errorf("openai stream recv failed: %v", err)
+			return nil, fmt.Errorf("openai stream recv failed: %w", err)
 		}
+		chunks = append(chunks, msg) // 聚合（ToolCalls也是分片返回的，需要整体拼接）
 		if len(msg.Content) > 0 {
-			fullResp.WriteString(msg.Content) // 聚合
-
 			cb(msg.Content) // 实时调用cb函数，方便主动发送给前端
 		}
 	}
 
-	return fullResp.String(), nil //返回完整内容，方便后续存储
+	return concatChunks(chunks) //返回完整内容，方便后续存储
 }
 
-func (o *OpenAIModel) GetModelType() string { return "openai" }
+func (o *OpenAIModel) GetModelType() string { return o.id }
 
 // =================== Ollama 实现 ===================
 
 // OllamaModel Ollama模型实现
 type OllamaModel struct {
-	llm model.ToolCallingChatModel
+	llm      model.ToolCallingChatModel
+	id       string
+	defaults []model.Option
 }
 
-func NewOllamaModel(ctx context.Context, baseURL, modelName string) (*OllamaModel, error) {
+func NewOllamaModel(ctx context.Context, conf *config.ModelConfig) (*OllamaModel, error) {
 	llm, err := ollama.NewChatModel(ctx, &ollama.ChatModelConfig{
-		BaseURL: baseURL,
-		Model:   modelName,
+		BaseURL: conf.BaseURL,
+		Model:   conf.ModelName,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("create ollama model failed: %v", err)
+		return nil, fmt.Errorf("create ollama model failed: %w", err)
 	}
-	return &OllamaModel{llm: llm}, nil
+	return &OllamaModel{llm: llm, id: conf.ID, defaults: defaultOptions(conf)}, nil
 }
 
-func (o *OllamaModel) GenerateResponse(ctx context.Context, messages []*schema.Message) (*schema.Message, error) {
-	resp, err := o.llm.Generate(ctx, messages)
+func (o *OllamaModel) GenerateResponse(ctx context.Context, messages []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	resp, err := o.llm.Generate(ctx, messages, mergeOptions(o.defaults, opts)...)
 	if err != nil {
-		return nil, fmt.Errorf("ollama generate failed: %v", err)
+		return nil, fmt.Errorf("ollama generate failed: %w", err)
 	}
 	return resp, nil
 }
 
-func (o *OllamaModel) StreamResponse(ctx context.Context, messages []*schema.Message, cb StreamCallback) (string, error) {
-	stream, err := o.llm.Stream(ctx, messages)
+func (o *OllamaModel) StreamResponse(ctx context.Context, messages []*schema.Message, cb StreamCallback, opts ...model.Option) (*schema.Message, error) {
+	stream, err := o.llm.Stream(ctx, messages, mergeOptions(o.defaults, opts)...)
 	if err != nil {
-		return "", fmt.Errorf("ollama stream failed: %v", err)
+		return nil, fmt.Errorf("ollama stream failed: %w", err)
 	}
 	defer stream.Close()
-	var fullResp strings.Builder
+	var chunks []*schema.Message
 	for {
 		msg, err := stream.Recv()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return "", fmt.Errorf("openai stream recv failed: %v", err)
+			return nil, fmt.Errorf("ollama stream recv failed: %w", err)
 		}
+		chunks = append(chunks, msg) // 聚合
 		if len(msg.Content) > 0 {
-			fullResp.WriteString(msg.Content) // 聚合
-			cb(msg.Content)                   // 实时调用cb函数，方便主动发送给前端
+			cb(msg.Content) // 实时调用cb函数，方便主动发送给前端
 		}
 	}
-	return fullResp.String(), nil //返回完整内容，方便后续存储
+	return concatChunks(chunks) //返回完整内容，方便后续存储
 }
 
-func (o *OllamaModel) GetModelType() string { return "ollama" }
+func (o *OllamaModel) GetModelType() string { return o.id }
+
+// 把流式返回的分片拼接成一条完整消息（Content逐段拼接，ToolCalls按Index合并）
+func concatChunks(chunks []*schema.Message) (*schema.Message, error) {
+	if len(chunks) == 0 {
+		return schema.AssistantMessage("", nil), nil
+	}
+	msg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		return nil, fmt.Errorf("concat stream chunks failed: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,174 @@
+package aihelper
+
+//滚动摘要
+//会话过长时，把最早的若干轮对话压缩成一段摘要，构造上下文时用摘要代替原始消息
+//摘要在回复结束后于后台生成，不增加用户请求的延迟
+import (
+	"GopherAI/config"
+	"GopherAI/model"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const summarySystemPrompt = "你是一个对话摘要助手。请把已有摘要和新增的对话合并成一段新的摘要，" +
+	"保留用户的身份信息、偏好、已达成的结论和尚未解决的问题，省略寒暄，使用中文，不超过500字。"
+
+var (
+	summaryModel     AIModel //用于生成摘要的模型，所有会话共用
+	summaryModelOnce sync.Once
+	summaryModelErr  error
+)
+
+// 获取（懒加载）摘要模型
+func getSummaryModel() (AIModel, error) {
+	summaryModelOnce.Do(func() {
+		modelType := config.GetConfig().SummaryConfig.ModelType
+		if modelType == "" {
+			modelType = config.GetConfig().DefaultModelType() //未单独配置时使用默认模型
+		}
+		summaryModel, summaryModelErr = GetGlobalFactory().CreateAIModel(ctx, modelType, nil)
+	})
+	return summaryModel, summaryModelErr
+}
+
+// SetSummary 恢复会话已有的摘要（从数据库加载会话时调用）
+func (a *AIHelper) SetSummary(summary string, summarizedUntil string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.summary = summary
+	a.summarizedUntil = summarizedUntil
+}
+
+// SetSummaryFunc 设置摘要的存储函数
+func (a *AIHelper) SetSummaryFunc(summaryFunc func(sessionID string, summary string, summarizedUntil string) error) {
+	a.summaryFunc = summaryFunc
+}
+
+// 摘要覆盖到分支中的哪个位置，摘要不在这条分支上时返回-1（调用方需持有读锁）
+func (a *AIHelper) summarizedIndex(path []*model.Message) int {
+	if a.summary == "" || a.summarizedUntil == "" {
+		return -1
+	}
+	for i, msg := range path {
+		if msg.MessageID == a.summarizedUntil {
+			return i
+		}
+	}
+	return -1
+}
+
+// 摘要对应的系统消息，没有摘要时返回空
+func (a *AIHelper) summaryMessages() []*schema.Message {
+	if a.summary == "" {
+		return nil
+	}
+	return []*schema.Message{schema.SystemMessage("以下是本次会话早先内容的摘要：\n" + a.summary)}
+}
+
+// 回复结束后检查是否需要摘要，需要则在后台执行（同一会话同时只会有一个摘要任务）
+func (a *AIHelper) maybeSummarize() {
+	conf := config.GetConfig().SummaryConfig
+	if !conf.Enabled || !a.summarizing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer a.summarizing.Store(false)
+		if err := a.summarize(conf.TriggerTokens); err != nil {
+			log.Printf("[AIHelper] session=%s summarize failed: %v\n", a.SessionID, err)
+		}
+	}()
+}
+
+// 把当前分支最早的若干轮对话压缩进摘要，只保留最近约一半预算的对话
+func (a *AIHelper) summarize(triggerTokens int) error {
+	if triggerTokens <= 0 {
+		triggerTokens = defaultMaxContextTokens / 2
+	}
+	tokenizer := EstimateTokenizer{}
+
+	a.mu.RLock()
+	oldUntil := a.summarizedUntil
+	path := a.activePath()
+	base := a.summarizedIndex(path) + 1
+	oldSummary := ""
+	if base > 0 {
+		oldSummary = a.summary //已有摘要在这条分支上，在它的基础上继续压缩
+	}
+	pending := path[base:]
+	a.mu.RUnlock()
+
+	total := 0
+	for _, msg := range pending {
+		total += tokenizer.CountTokens(msg.Content)
+	}
+	if total <= triggerTokens {
+		return nil
+	}
+
+	//从新到旧保留不超过一半预算的消息，并把切分点对齐到用户消息，保证压缩的都是完整的轮次
+	keep, cut := 0, len(pending)
+	for i := len(pending) - 1; i > 0; i-- {
+		keep += tokenizer.CountTokens(pending[i].Content)
+		if keep > triggerTokens/2 {
+			break
+		}
+		if pending[i].IsUser {
+			cut = i
+		}
+	}
+	if cut == len(pending) {
+		return nil //最近一轮本身就超出预算，没有可以压缩的完整轮次
+	}
+
+	var transcript strings.Builder
+	for _, msg := range pending[:cut] {
+		switch {
+		case msg.IsUser:
+			transcript.WriteString("用户: ")
+		case msg.ToolCallID != "":
+			transcript.WriteString("工具(" + msg.ToolName + ")结果: ")
+		case msg.ToolCalls != "":
+			transcript.WriteString("助手调用工具: " + msg.ToolCalls + "\n")
+			continue
+		default:
+			transcript.WriteString("助手: ")
+		}
+		transcript.WriteString(msg.Content)
+		transcript.WriteString("\n")
+	}
+
+	summarizer, err := getSummaryModel()
+	if err != nil {
+		return err
+	}
+	input := []*schema.Message{
+		schema.SystemMessage(summarySystemPrompt),
+		schema.UserMessage(fmt.Sprintf("已有摘要：\n%s\n\n新增对话：\n%s", oldSummary, transcript.String())),
+	}
+	resp, err := summarizer.GenerateResponse(context.Background(), input)
+	if err != nil {
+		return err
+	}
+	a.recordBackgroundUsage(pending[0].UserName, summarizer, resp, input)
+
+	newUntil := pending[cut-1].MessageID
+	a.mu.Lock()
+	//摘要期间摘要已被其他任务更新，这次结果丢弃
+	if a.summarizedUntil != oldUntil {
+		a.mu.Unlock()
+		return nil
+	}
+	a.summary = resp.Content
+	a.summarizedUntil = newUntil
+	a.mu.Unlock()
+
+	if a.summaryFunc != nil {
+		return a.summaryFunc(a.SessionID, resp.Content, newUntil)
+	}
+	return nil
+}
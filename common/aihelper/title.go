@@ -0,0 +1,153 @@
+package aihelper
+
+//会话标题自动生成
+//第一轮对话结束后，在后台用一个便宜的模型根据问答生成简短标题
+//用户手动重命名过的会话不再自动生成
+import (
+	"GopherAI/config"
+	"GopherAI/model"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const titleSystemPrompt = "你是一个会话标题生成助手。请根据用户的问题和助手的回答，为这次会话起一个简短的标题，" +
+	"概括讨论的主题，不超过%d个字，只输出标题本身，不要加引号、标点或任何解释。"
+
+var (
+	titleModel     AIModel //用于生成标题的模型，所有会话共用
+	titleModelOnce sync.Once
+	titleModelErr  error
+)
+
+// 获取（懒加载）标题模型
+func getTitleModel() (AIModel, error) {
+	titleModelOnce.Do(func() {
+		modelType := config.GetConfig().TitleConfig.ModelType
+		if modelType == "" {
+			modelType = config.GetConfig().DefaultModelType() //未单独配置时使用默认模型
+		}
+		titleModel, titleModelErr = GetGlobalFactory().CreateAIModel(ctx, modelType, nil)
+	})
+	return titleModel, titleModelErr
+}
+
+// SetTitled 标记会话已经有了生成的（或用户起的）标题，之后不再自动生成（从数据库加载会话时调用）
+func (a *AIHelper) SetTitled(titled bool) {
+	a.titled.Store(titled)
+}
+
+// SetTitleFunc 设置标题的存储函数，返回false表示标题没有被采用（如用户已经手动重命名）
+func (a *AIHelper) SetTitleFunc(titleFunc func(sessionID string, title string) (bool, error)) {
+	a.titleFunc = titleFunc
+}
+
+// GenerateTitle 会话还没有标题时在后台生成，返回的channel在生成成功后收到标题，失败或未采用时直接关闭
+// 不需要生成时返回nil
+func (a *AIHelper) GenerateTitle() <-chan string {
+	conf := config.GetConfig().TitleConfig
+	if !conf.Enabled || !a.titled.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	a.mu.RLock()
+	path := a.activePath()
+	a.mu.RUnlock()
+	question, answer := firstExchange(path)
+	if question == "" || answer == "" {
+		a.titled.Store(false)
+		return nil
+	}
+	userName := path[0].UserName //标题消耗的token计入会话所属用户
+
+	ch := make(chan string, 1)
+	go func() {
+		defer close(ch)
+		title, err := a.generateTitle(conf, userName, question, answer)
+		if err != nil {
+			a.titled.Store(false) //失败后下一轮对话再试
+			log.Printf("[AIHelper] session=%s generate title failed: %v\n", a.SessionID, err)
+			return
+		}
+		if title == "" || a.titleFunc == nil {
+			return
+		}
+		ok, err := a.titleFunc(a.SessionID, title)
+		if err != nil {
+			a.titled.Store(false)
+			log.Printf("[AIHelper] session=%s save title failed: %v\n", a.SessionID, err)
+			return
+		}
+		if ok {
+			ch <- title
+		}
+	}()
+	return ch
+}
+
+// 分支上第一轮的问题和最终回答
+func firstExchange(path []*model.Message) (string, string) {
+	question := ""
+	for _, msg := range path {
+		switch {
+		case msg.IsUser:
+			if question != "" {
+				return "", "" //第一轮没有最终回答
+			}
+			question = msg.Content
+		case question != "" && msg.ToolCalls == "" && msg.ToolCallID == "" && msg.Content != "":
+			return question, msg.Content
+		}
+	}
+	return "", ""
+}
+
+// 调用标题模型，并清理模型输出中多余的引号、标点和换行
+func (a *AIHelper) generateTitle(conf config.TitleConfig, userName string, question string, answer string) (string, error) {
+	maxLength := conf.MaxLength
+	if maxLength <= 0 {
+		maxLength = 20
+	}
+	timeout := time.Duration(conf.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+
+	titler, err := getTitleModel()
+	if err != nil {
+		return "", err
+	}
+	titleCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	input := []*schema.Message{
+		schema.SystemMessage(fmt.Sprintf(titleSystemPrompt, maxLength)),
+		schema.UserMessage("问题：\n" + clip(question, 1000) + "\n\n回答：\n" + clip(answer, 1000)),
+	}
+	resp, err := titler.GenerateResponse(titleCtx, input)
+	if err != nil {
+		return "", err
+	}
+	a.recordBackgroundUsage(userName, titler, resp, input)
+
+	title := strings.TrimSpace(resp.Content)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimPrefix(title, "标题：")
+	title = strings.Trim(title, " \t\"'“”‘’「」《》。.!！?？:：")
+	return clip(title, maxLength), nil
+}
+
+// 按字符截断
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
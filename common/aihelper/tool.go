@@ -0,0 +1,111 @@
+package aihelper
+
+//工具（函数调用）注册中心
+//1.业务方把Go函数连同JSON Schema一起注册进来
+//2.AIHelper通过WithTools把工具描述绑定给模型
+//3.模型返回ToolCalls后，由注册中心负责找到对应函数并执行
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+)
+
+// 单轮对话中最多允许的工具调用轮数，防止模型反复调用工具陷入死循环
+const maxToolRounds = 5
+
+// ToolHandler 工具的执行函数，arguments为模型生成的JSON参数，返回值会作为工具结果回传给模型
+type ToolHandler func(ctx context.Context, arguments string) (string, error)
+
+// Tool 一个可被模型调用的工具
+type Tool struct {
+	Info    *schema.ToolInfo //工具描述（名称，用途，参数Schema）
+	Handler ToolHandler      //真正执行的Go函数
+}
+
+// ToolRegistry 工具注册中心
+type ToolRegistry struct {
+	tools map[string]*Tool
+	order []string //保持注册顺序，保证每次绑定给模型的工具列表稳定
+	mu    sync.RWMutex
+}
+
+var (
+	globalToolRegistry *ToolRegistry
+	toolRegistryOnce   sync.Once
+)
+
+// GetGlobalToolRegistry 获取全局工具注册中心
+func GetGlobalToolRegistry() *ToolRegistry {
+	toolRegistryOnce.Do(func() {
+		globalToolRegistry = NewToolRegistry()
+	})
+	return globalToolRegistry
+}
+
+// NewToolRegistry 创建新的工具注册中心
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools: make(map[string]*Tool),
+	}
+}
+
+// RegisterTool 注册工具，paramsSchema为参数的JSON Schema（为空表示无参数）
+func (r *ToolRegistry) RegisterTool(name string, desc string, paramsSchema string, handler ToolHandler) error {
+	if name == "" || handler == nil {
+		return fmt.Errorf("tool name and handler are required")
+	}
+
+	info := &schema.ToolInfo{
+		Name: name,
+		Desc: desc,
+	}
+	if paramsSchema != "" {
+		s := new(jsonschema.Schema)
+		if err := json.Unmarshal([]byte(paramsSchema), s); err != nil {
+			return fmt.Errorf("invalid params schema for tool %s: %v", name, err)
+		}
+		info.ParamsOneOf = schema.NewParamsOneOfByJSONSchema(s)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.tools[name] = &Tool{Info: info, Handler: handler}
+	return nil
+}
+
+// ToolInfos 获取所有工具的描述，用于绑定给模型
+func (r *ToolRegistry) ToolInfos() []*schema.ToolInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]*schema.ToolInfo, 0, len(r.order))
+	for _, name := range r.order {
+		infos = append(infos, r.tools[name].Info)
+	}
+	return infos
+}
+
+// Execute 执行模型返回的一次工具调用，并把结果包装成Tool角色的消息
+// 工具不存在或执行失败时，把错误信息作为结果返回给模型，让模型自行决定如何继续
+func (r *ToolRegistry) Execute(ctx context.Context, call schema.ToolCall) *schema.Message {
+	r.mu.RLock()
+	tool, ok := r.tools[call.Function.Name]
+	r.mu.RUnlock()
+
+	var result string
+	if !ok {
+		result = fmt.Sprintf("error: tool %s not found", call.Function.Name)
+	} else if out, err := tool.Handler(ctx, call.Function.Arguments); err != nil {
+		result = fmt.Sprintf("error: %v", err)
+	} else {
+		result = out
+	}
+
+	return schema.ToolMessage(result, call.ID, schema.WithToolName(call.Function.Name))
+}
@@ -0,0 +1,142 @@
+package aihelper
+
+//消息树
+//每条消息记录父消息ID，编辑问题或重新生成回答时在同一位置产生新的分支，旧分支保留
+//会话记录当前所在分支的末尾消息，构造上下文、展示历史时都只取从根到该消息的这条路径
+import (
+	"GopherAI/model"
+	"context"
+	"log"
+)
+
+// 把消息加入消息树并设为当前分支末尾（调用方需持有写锁）
+func (a *AIHelper) insertNode(msg *model.Message) {
+	a.messages = append(a.messages, msg)
+	a.nodes[msg.MessageID] = msg
+	a.children[msg.ParentID] = append(a.children[msg.ParentID], msg)
+	a.activeLeaf = msg.MessageID
+}
+
+// 当前分支：从根到activeLeaf的消息（调用方需持有读锁）
+func (a *AIHelper) activePath() []*model.Message {
+	var path []*model.Message
+	for id := a.activeLeaf; id != "" && len(path) <= len(a.messages); {
+		msg, ok := a.nodes[id]
+		if !ok {
+			break
+		}
+		path = append(path, msg)
+		id = msg.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// SetLeafFunc 设置当前分支的存储函数
+func (a *AIHelper) SetLeafFunc(leafFunc func(sessionID string, leafID string) error) {
+	a.leafFunc = leafFunc
+}
+
+// 持久化当前分支
+func (a *AIHelper) saveActiveLeaf() {
+	if a.leafFunc == nil {
+		return
+	}
+	a.mu.RLock()
+	leafID := a.activeLeaf
+	a.mu.RUnlock()
+	if err := a.leafFunc(a.SessionID, leafID); err != nil {
+		log.Printf("[AIHelper] session=%s save active leaf failed: %v\n", a.SessionID, err)
+	}
+}
+
+// SetActiveLeaf 恢复会话保存的当前分支（从数据库加载会话时调用），消息不存在时保持默认（最后加载的消息）
+func (a *AIHelper) SetActiveLeaf(leafID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.nodes[leafID]; ok {
+		a.activeLeaf = leafID
+	}
+}
+
+// GetSiblings 获取与某条消息处在同一位置的所有版本（包含自身），以及该消息在其中的下标
+func (a *AIHelper) GetSiblings(messageID string) ([]string, int) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	msg, ok := a.nodes[messageID]
+	if !ok {
+		return nil, 0
+	}
+	siblings := a.children[msg.ParentID]
+	ids := make([]string, 0, len(siblings))
+	index := 0
+	for i, sibling := range siblings {
+		if sibling.MessageID == messageID {
+			index = i
+		}
+		ids = append(ids, sibling.MessageID)
+	}
+	return ids, index
+}
+
+// SwitchBranch 切换到某条消息所在的分支，沿着每一层最新的子消息走到末尾
+func (a *AIHelper) SwitchBranch(messageID string) error {
+	a.mu.Lock()
+	if _, ok := a.nodes[messageID]; !ok {
+		a.mu.Unlock()
+		return ErrMessageNotFound
+	}
+	leaf := messageID
+	for steps := 0; steps < len(a.messages); steps++ {
+		children := a.children[leaf]
+		if len(children) == 0 {
+			break
+		}
+		leaf = children[len(children)-1].MessageID
+	}
+	a.activeLeaf = leaf
+	a.mu.Unlock()
+
+	a.saveActiveLeaf()
+	return nil
+}
+
+// Regenerate 为当前分支最后一条用户消息重新生成回答，新回答作为原回答的兄弟分支，cb为nil时同步生成
+func (a *AIHelper) Regenerate(userName string, ctx context.Context, cb ReplyCallback) (*model.Message, error) {
+	a.mu.Lock()
+	path := a.activePath()
+	index := -1
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].IsUser {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		a.mu.Unlock()
+		return nil, ErrMessageNotFound
+	}
+	a.activeLeaf = path[index].MessageID //回到用户消息，新回答挂在它下面
+	a.mu.Unlock()
+
+	return a.respond(ctx, userName, cb)
+}
+
+// EditAndResend 修改某条用户消息并从这里重新开始对话，修改后的消息作为原消息的兄弟分支（保留原消息的图片），cb为nil时同步生成
+func (a *AIHelper) EditAndResend(userName string, ctx context.Context, cb ReplyCallback, messageID string, userQuestion string) (*model.Message, error) {
+	a.mu.Lock()
+	msg, ok := a.nodes[messageID]
+	if !ok || !msg.IsUser {
+		a.mu.Unlock()
+		return nil, ErrMessageNotFound
+	}
+	a.activeLeaf = msg.ParentID //回到原消息的父消息，修改后的消息挂在它下面
+	attachments := msg.Attachments
+	a.mu.Unlock()
+
+	edited := &model.Message{Content: userQuestion, UserName: userName, IsUser: true, Attachments: attachments}
+	a.addMessage(edited, true)
+	return a.respond(ctx, userName, cb)
+}
@@ -0,0 +1,74 @@
+package aihelper
+
+//同一会话的对话轮次串行执行
+//两轮对话并发时都会追加到同一条分支上，并各自读取不包含对方问题的历史，回答交错在一起
+//每轮对话（以及切换分支、修改配置）先取得会话的轮次锁，后到的请求排队等待，超过turnWaitSeconds返回会话忙
+//消息的创建时间在追加到内存时确定并随消息入库，数据库中的顺序与内存一致
+import (
+	"GopherAI/config"
+	"context"
+	"sync"
+	"time"
+)
+
+// 一个会话的轮次锁，waiters为0时从表中删除
+type turnLock struct {
+	ch      chan struct{} //容量为1，放入成功表示持有锁
+	waiters int           //持有和等待该锁的请求数
+}
+
+var (
+	turnLocks   = make(map[string]*turnLock) //map[会话id]*turnLock
+	turnLocksMu sync.Mutex
+)
+
+// 等待轮次锁的最长时间
+func turnWait() time.Duration {
+	return time.Duration(config.GetConfig().SessionCacheConfig.TurnWaitSeconds) * time.Second
+}
+
+// 获取会话的轮次锁，超时返回ErrSessionBusy，返回释放函数
+func acquireTurn(c context.Context, sessionID string) (func(), error) {
+	turnLocksMu.Lock()
+	lock, exists := turnLocks[sessionID]
+	if !exists {
+		lock = &turnLock{ch: make(chan struct{}, 1)}
+		turnLocks[sessionID] = lock
+	}
+	lock.waiters++
+	turnLocksMu.Unlock()
+
+	leave := func() {
+		turnLocksMu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(turnLocks, sessionID)
+		}
+		turnLocksMu.Unlock()
+	}
+
+	//没有等待时间时只尝试一次
+	select {
+	case lock.ch <- struct{}{}:
+	default:
+		timer := time.NewTimer(turnWait())
+		defer timer.Stop()
+		select {
+		case lock.ch <- struct{}{}:
+		case <-timer.C:
+			leave()
+			return nil, ErrSessionBusy
+		case <-c.Done():
+			leave()
+			return nil, c.Err()
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.ch
+			leave()
+		})
+	}, nil
+}
@@ -0,0 +1,32 @@
+package attachment //聊天图片的文件存储
+
+import (
+	"GopherAI/config"
+	"os"
+	"path/filepath"
+)
+
+const defaultDir = "data/attachments"
+
+// 图片文件路径，文件名即附件ID（uuid），不使用用户上传的文件名
+func filePath(id string) string {
+	dir := config.GetConfig().AttachmentConfig.Dir
+	if dir == "" {
+		dir = defaultDir
+	}
+	return filepath.Join(dir, filepath.Base(id))
+}
+
+// Save 保存图片内容
+func Save(id string, data []byte) error {
+	path := filePath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Load 读取图片内容
+func Load(id string) ([]byte, error) {
+	return os.ReadFile(filePath(id))
+}
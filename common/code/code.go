@@ -17,10 +17,17 @@ const (
 	CodeInvalidCaptcha   Code = 2008
 	CodeRecordNotFound   Code = 2009
 	CodeIllegalPassword  Code = 2010
+	CodeFileTooLarge     Code = 2011
+	CodeUnsupportedFile  Code = 2012
+	CodeFeatureDisabled  Code = 2013
 
 	CodeForbidden Code = 3001
 
-	CodeServerBusy Code = 4001
+	CodeServerBusy      Code = 4001
+	CodeTooManyRequests Code = 4002
+	CodeQuotaExceeded   Code = 4003
+	CodeTooManyStreams  Code = 4004
+	CodeSessionBusy     Code = 4005
 
 	AIModelNotFind    Code = 5001
 	AIModelCannotOpen Code = 5002
@@ -40,10 +47,17 @@ var msg = map[Code]string{
 	CodeInvalidCaptcha:   "验证码错误",
 	CodeRecordNotFound:   "记录不存在",
 	CodeIllegalPassword:  "密码不合法",
+	CodeFileTooLarge:     "文件过大",
+	CodeUnsupportedFile:  "不支持的文件类型",
+	CodeFeatureDisabled:  "该功能未开启",
 
 	CodeForbidden: "权限不足",
 
-	CodeServerBusy: "服务繁忙",
+	CodeServerBusy:      "服务繁忙",
+	CodeTooManyRequests: "请求过于频繁，请稍后再试",
+	CodeQuotaExceeded:   "今日额度已用完",
+	CodeTooManyStreams:  "同时进行的对话过多，请稍后再试",
+	CodeSessionBusy:     "会话正在处理其他请求，请稍后再试",
 
 	AIModelNotFind:    "模型不存在",
 	AIModelCannotOpen: "无法打开模型",
@@ -70,10 +70,32 @@ func migration() error {
 		new(model.User),
 		new(model.Session),
 		new(model.Message),
-	) //如果表不存在，则创建表(三个表，用户表，会话表，信息表)
+		new(model.Persona),
+		new(model.KnowledgeBase),
+		new(model.Document),
+		new(model.Chunk),
+		new(model.SessionKnowledgeBase),
+		new(model.Attachment),
+		new(model.Migration),
+	) //如果表不存在，则创建表(用户表，会话表，信息表，人设表，知识库相关表，聊天图片表，数据迁移记录表)
 	//如果字段不存在，则添加字段
 }
 
+// RunOnce 执行一次性的数据迁移：执行成功后记录到迁移表，之后启动时直接跳过，不再扫描数据
+func RunOnce(name string, fn func() error) error {
+	var n int64
+	if err := DB.Model(&model.Migration{}).Where("name = ?", name).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return DB.Create(&model.Migration{Name: name}).Error
+}
+
 func InsertUser(user *model.User) (*model.User, error) {
 	err := DB.Create(&user).Error
 	//获取错误信息
@@ -4,25 +4,57 @@ import (
 	"GopherAI/dao/message"
 	"GopherAI/model"
 	"encoding/json"
+	"time"
 
 	"github.com/streadway/amqp"
 )
 
 type MessageMQParam struct {
-	SessionID string `json:"session_id"` //会话ID
-	Content   string `json:"content"`    //消息内容
-	UserName  string `json:"user_name"`  //用户名
-	IsUser    bool   `json:"is_user"`    //是否为用户消息
+	MessageID  string `json:"message_id"`             //消息ID
+	ParentID   string `json:"parent_id,omitempty"`    //父消息ID
+	SessionID  string `json:"session_id"`             //会话ID
+	Content    string `json:"content"`                //消息内容
+	UserName   string `json:"user_name"`              //用户名
+	IsUser     bool   `json:"is_user"`                //是否为用户消息
+	ToolCalls  string `json:"tool_calls,omitempty"`   //助手发起的工具调用（JSON）
+	ToolCallID string `json:"tool_call_id,omitempty"` //工具结果对应的调用ID
+	ToolName   string `json:"tool_name,omitempty"`    //工具名
+	ModelID    string `json:"model_id,omitempty"`     //生成回复的模型
+	//用量统计
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	TotalTokens      int    `json:"total_tokens,omitempty"`
+	LatencyMs        int64  `json:"latency_ms,omitempty"`
+	Truncated        bool   `json:"truncated,omitempty"`   //生成被中途停止
+	Sources          string `json:"sources,omitempty"`     //引用的知识库资料
+	Attachments      string `json:"attachments,omitempty"` //附带的图片
+	//追加到内存时的时间，消费端按它入库，保证数据库中的顺序和内存一致
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // 将消息数据序列化为JSON
 // 用于投递到RabbitMQ
-func GenerateMessageMQParam(sessionID string, content string, userName string, IsUser bool) []byte {
+func GenerateMessageMQParam(msg *model.Message) []byte {
 	param := MessageMQParam{
-		SessionID: sessionID,
-		Content:   content,
-		UserName:  userName,
-		IsUser:    IsUser,
+		MessageID:  msg.MessageID,
+		ParentID:   msg.ParentID,
+		SessionID:  msg.SessionID,
+		Content:    msg.Content,
+		UserName:   msg.UserName,
+		IsUser:     msg.IsUser,
+		ToolCalls:  msg.ToolCalls,
+		ToolCallID: msg.ToolCallID,
+		ToolName:   msg.ToolName,
+		ModelID:    msg.ModelID,
+
+		PromptTokens:     msg.PromptTokens,
+		CompletionTokens: msg.CompletionTokens,
+		TotalTokens:      msg.TotalTokens,
+		LatencyMs:        msg.LatencyMs,
+		Truncated:        msg.Truncated,
+		Sources:          msg.Sources,
+		Attachments:      msg.Attachments,
+		CreatedAt:        msg.CreatedAt,
 	}
 	data, _ := json.Marshal(param)
 	return data
@@ -38,13 +70,28 @@ func MQMessage(msg *amqp.Delivery) error {
 
 	//转化为数据库模型
 	newMsg := &model.Message{
-		SessionID: param.SessionID,
-		Content:   param.Content,
-		UserName:  param.UserName,
-		IsUser:    param.IsUser,
+		MessageID:  param.MessageID,
+		ParentID:   param.ParentID,
+		SessionID:  param.SessionID,
+		Content:    param.Content,
+		UserName:   param.UserName,
+		IsUser:     param.IsUser,
+		ToolCalls:  param.ToolCalls,
+		ToolCallID: param.ToolCallID,
+		ToolName:   param.ToolName,
+		ModelID:    param.ModelID,
+
+		PromptTokens:     param.PromptTokens,
+		CompletionTokens: param.CompletionTokens,
+		TotalTokens:      param.TotalTokens,
+		LatencyMs:        param.LatencyMs,
+		Truncated:        param.Truncated,
+		Sources:          param.Sources,
+		Attachments:      param.Attachments,
+		CreatedAt:        param.CreatedAt,
 	}
 
-	//消费者异步插入到数据库中
-	message.CreateMessage(newMsg)
-	return nil
+	//消费者异步插入到数据库中，失败时返回错误交给消费端记录
+	_, err = message.CreateMessage(newMsg)
+	return err
 }
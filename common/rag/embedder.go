@@ -0,0 +1,99 @@
+package rag
+
+import (
+	"GopherAI/config"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/cloudwego/eino-ext/libs/acl/openai"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/eino-contrib/ollama/api"
+)
+
+const defaultBatchSize = 10
+
+var (
+	embedder     embedding.Embedder //所有知识库共用一个向量模型，换模型后需要重新上传文档
+	embedderOnce sync.Once
+	embedderErr  error
+)
+
+// GetEmbedder 获取（懒加载）配置文件中的向量模型
+func GetEmbedder() (embedding.Embedder, error) {
+	embedderOnce.Do(func() {
+		embedder, embedderErr = NewEmbedder(context.Background(), &config.GetConfig().EmbeddingConfig)
+	})
+	return embedder, embedderErr
+}
+
+// NewEmbedder 根据配置创建向量模型
+func NewEmbedder(ctx context.Context, conf *config.EmbeddingConfig) (embedding.Embedder, error) {
+	switch conf.Provider {
+	case "openai", "":
+		return openai.NewEmbeddingClient(ctx, &openai.EmbeddingConfig{
+			BaseURL: conf.BaseURL,
+			APIKey:  os.Getenv(conf.APIKeyEnv),
+			Model:   conf.ModelName,
+		})
+	case "ollama":
+		base, err := url.Parse(conf.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ollama base url: %w", err)
+		}
+		return &ollamaEmbedder{cli: api.NewClient(base, http.DefaultClient), model: conf.ModelName}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider: %s", conf.Provider)
+	}
+}
+
+// ollamaEmbedder 通过Ollama的/api/embed接口向量化
+type ollamaEmbedder struct {
+	cli   *api.Client
+	model string
+}
+
+func (o *ollamaEmbedder) EmbedStrings(ctx context.Context, texts []string, opts ...embedding.Option) ([][]float64, error) {
+	options := embedding.GetCommonOptions(&embedding.Options{Model: &o.model}, opts...)
+	resp, err := o.cli.Embed(ctx, &api.EmbedRequest{Model: *options.Model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("ollama embed failed: %w", err)
+	}
+	out := make([][]float64, len(resp.Embeddings))
+	for i, vec := range resp.Embeddings {
+		out[i] = make([]float64, len(vec))
+		for j, v := range vec {
+			out[i][j] = float64(v)
+		}
+	}
+	return out, nil
+}
+
+// EmbedTexts 分批向量化，避免单次请求过大
+func EmbedTexts(ctx context.Context, texts []string) ([][]float64, error) {
+	e, err := GetEmbedder()
+	if err != nil {
+		return nil, err
+	}
+	batch := config.GetConfig().EmbeddingConfig.BatchSize
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+
+	out := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += batch {
+		end := min(start+batch, len(texts))
+		vecs, err := e.EmbedStrings(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(vecs) != end-start {
+			return nil, fmt.Errorf("embedding count mismatch: want %d, got %d", end-start, len(vecs))
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
@@ -0,0 +1,142 @@
+package rag
+
+import (
+	"GopherAI/common/vectorstore"
+	"GopherAI/dao/knowledge"
+	"GopherAI/model"
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+)
+
+// 向量存储中切片的元数据字段
+const (
+	storeName          = "knowledge"
+	fieldKnowledgeBase = "knowledge_base_id"
+	fieldDocument      = "document_id"
+)
+
+// Hit 检索命中的切片
+type Hit struct {
+	KnowledgeBaseID uint
+	DocumentID      uint
+	Content         string
+	Score           float64
+}
+
+// 知识库切片所在的向量存储
+func getStore() (vectorstore.VectorStore, error) {
+	return vectorstore.Get(storeName, []string{fieldKnowledgeBase, fieldDocument})
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// AddChunks 把切片写入向量存储，chunks与vectors一一对应
+func AddChunks(ctx context.Context, chunks []model.Chunk, vectors [][]float64) error {
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+	records := make([]vectorstore.Record, 0, len(chunks))
+	for i, c := range chunks {
+		records = append(records, vectorstore.Record{
+			ID:      formatID(c.ID),
+			Vector:  vectors[i],
+			Content: c.Content,
+			Metadata: map[string]string{
+				fieldKnowledgeBase: formatID(c.KnowledgeBaseID),
+				fieldDocument:      formatID(c.DocumentID),
+			},
+		})
+	}
+	return store.Upsert(ctx, records)
+}
+
+// RemoveDocument 删除某篇文档的所有切片
+func RemoveDocument(ctx context.Context, documentID uint) error {
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+	_, err = store.DeleteByFilter(ctx, vectorstore.Filter{fieldDocument: {formatID(documentID)}})
+	return err
+}
+
+// RemoveKnowledgeBase 删除整个知识库的切片
+func RemoveKnowledgeBase(ctx context.Context, knowledgeBaseID uint) error {
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+	_, err = store.DeleteByFilter(ctx, vectorstore.Filter{fieldKnowledgeBase: {formatID(knowledgeBaseID)}})
+	return err
+}
+
+// Search 在指定知识库中检索与vector最相似的topK个切片
+func Search(ctx context.Context, knowledgeBaseIDs []uint, vector []float64, topK int) ([]Hit, error) {
+	store, err := getStore()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(knowledgeBaseIDs))
+	for _, id := range knowledgeBaseIDs {
+		ids = append(ids, formatID(id))
+	}
+	results, err := store.Query(ctx, vector, topK, vectorstore.Filter{fieldKnowledgeBase: ids})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(results))
+	for _, r := range results {
+		kbID, _ := strconv.ParseUint(r.Metadata[fieldKnowledgeBase], 10, 64)
+		docID, _ := strconv.ParseUint(r.Metadata[fieldDocument], 10, 64)
+		hits = append(hits, Hit{
+			KnowledgeBaseID: uint(kbID),
+			DocumentID:      uint(docID),
+			Content:         r.Content,
+			Score:           r.Score,
+		})
+	}
+	return hits, nil
+}
+
+// LoadIndex 启动时把数据库中的切片向量写入向量存储，存储中已有数据（如redis后端）时跳过
+func LoadIndex() error {
+	ctx := context.Background()
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+	if n, err := store.Count(ctx); err != nil {
+		return err
+	} else if n > 0 {
+		log.Printf("Vector store already has %d knowledge chunks, skip loading", n)
+		return nil
+	}
+
+	count := 0
+	err = knowledge.EachChunks(500, func(chunks []model.Chunk) error {
+		vectors := make([][]float64, 0, len(chunks))
+		valid := make([]model.Chunk, 0, len(chunks))
+		for _, c := range chunks {
+			var vec []float64
+			if err := json.Unmarshal([]byte(c.Embedding), &vec); err != nil {
+				log.Printf("LoadIndex skip chunk %d: %v", c.ID, err)
+				continue
+			}
+			valid = append(valid, c)
+			vectors = append(vectors, vec)
+		}
+		count += len(valid)
+		return AddChunks(ctx, valid, vectors)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d knowledge chunks into vector store", count)
+	return nil
+}
@@ -0,0 +1,63 @@
+package rag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ErrUnsupportedFile 不支持的文档类型
+var ErrUnsupportedFile = errors.New("unsupported file type, only .txt .md .pdf are allowed")
+
+// SupportedFile 判断文件类型是否支持
+func SupportedFile(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".txt", ".md", ".markdown", ".pdf":
+		return true
+	}
+	return false
+}
+
+// ExtractText 按文件类型提取纯文本
+func ExtractText(fileName string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".txt", ".md", ".markdown":
+		if !utf8.Valid(data) {
+			return "", errors.New("file is not valid UTF-8 text")
+		}
+		return string(data), nil
+	case ".pdf":
+		return extractPDF(data)
+	default:
+		return "", ErrUnsupportedFile
+	}
+}
+
+func extractPDF(data []byte) (text string, err error) {
+	defer func() {
+		//pdf库遇到损坏的文件可能panic
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parse pdf failed: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open pdf failed: %w", err)
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", fmt.Errorf("read pdf text failed: %w", err)
+	}
+	out, err := io.ReadAll(plain)
+	if err != nil {
+		return "", fmt.Errorf("read pdf text failed: %w", err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,64 @@
+package rag
+
+import (
+	"GopherAI/config"
+	"GopherAI/dao/knowledge"
+	"GopherAI/model"
+	"context"
+)
+
+const defaultTopK = 4
+
+// Retriever 基于全局索引的检索器，实现aihelper.Retriever
+type Retriever struct{}
+
+// Retrieve 在指定知识库中检索与query相关的资料，按相似度从高到低编号
+func (Retriever) Retrieve(ctx context.Context, knowledgeBaseIDs []uint, query string) ([]model.Source, error) {
+	if len(knowledgeBaseIDs) == 0 || query == "" {
+		return nil, nil
+	}
+
+	vectors, err := EmbedTexts(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	conf := config.GetConfig().RAGConfig
+	topK := conf.TopK
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+	hits, err := Search(ctx, knowledgeBaseIDs, vectors[0], topK)
+	if err != nil {
+		return nil, err
+	}
+
+	var docIDs []uint
+	kept := hits[:0]
+	for _, h := range hits {
+		if h.Score < conf.MinScore {
+			continue
+		}
+		kept = append(kept, h)
+		docIDs = append(docIDs, h.DocumentID)
+	}
+	if len(kept) == 0 {
+		return nil, nil
+	}
+
+	names, err := knowledge.GetDocumentNames(docIDs)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]model.Source, 0, len(kept))
+	for i, h := range kept {
+		sources = append(sources, model.Source{
+			Index:      i + 1,
+			DocumentID: h.DocumentID,
+			FileName:   names[h.DocumentID],
+			Content:    h.Content,
+			Score:      h.Score,
+		})
+	}
+	return sources, nil
+}
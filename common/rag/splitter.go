@@ -0,0 +1,76 @@
+package rag
+
+import (
+	"strings"
+)
+
+const (
+	defaultChunkSize    = 500
+	defaultChunkOverlap = 50
+)
+
+// SplitText 把文本切成不超过size个字符的切片，相邻切片重叠overlap个字符
+// 优先在段落、换行、句末标点处切分，尽量不把一句话拆开
+func SplitText(text string, size int, overlap int) []string {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = defaultChunkOverlap
+	}
+	if overlap >= size {
+		overlap = size / 10
+	}
+
+	runes := []rune(strings.TrimSpace(normalizeSpace(text)))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			end = cutPoint(runes, start, end)
+		}
+
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// 在[start, end)的后半段找一个合适的切分位置，找不到时直接在end处切
+func cutPoint(runes []rune, start int, end int) int {
+	for _, seps := range []string{"\n\n", "\n", "。！？.!?", "；;，, "} {
+		for i := end - 1; i > start+(end-start)/2; i-- {
+			if seps == "\n\n" {
+				if runes[i] == '\n' && runes[i-1] == '\n' {
+					return i + 1
+				}
+				continue
+			}
+			if strings.ContainsRune(seps, runes[i]) {
+				return i + 1
+			}
+		}
+	}
+	return end
+}
+
+// 统一换行并去掉多余的空行
+func normalizeSpace(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return text
+}
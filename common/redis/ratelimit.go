@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"GopherAI/config"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+//限流相关的Redis操作
+//所有计数都放在Redis中，多个后端实例共享同一份限额
+
+// 滑动窗口：先清理窗口外的记录，未超限则记录本次请求并返回0，否则返回还需等待的毫秒数
+var slidingWindowScript = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+if redis.call('ZCARD', key) < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`
+
+// 并发槽位：score为槽位的过期时间，实例崩溃没来得及释放的槽位过期后自动回收
+var acquireSlotScript = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', key, 0, now)
+if redis.call('ZCARD', key) < limit then
+	redis.call('ZADD', key, now + ttl, ARGV[4])
+	redis.call('PEXPIRE', key, ttl)
+	return 1
+end
+return 0
+`
+
+// AllowRequest 滑动窗口限流，返回是否放行以及被拒绝时需要等待的时间
+func AllowRequest(userName string, limit int, window time.Duration) (bool, time.Duration, error) {
+	key := fmt.Sprintf(config.DefaultRedisKeyConfig.RateLimitPrefix, userName)
+	now := time.Now().UnixMilli()
+	wait, err := Rdb.Eval(ctx, slidingWindowScript, []string{key},
+		now, window.Milliseconds(), limit, strconv.FormatInt(now, 10)+"-"+uuid.New().String()).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	return wait <= 0, time.Duration(wait) * time.Millisecond, nil
+}
+
+// AcquireStreamSlot 占用一个流式输出的并发槽位，成功时返回槽位id，用于结束后释放
+func AcquireStreamSlot(userName string, limit int, ttl time.Duration) (string, bool, error) {
+	key := fmt.Sprintf(config.DefaultRedisKeyConfig.StreamSlotPrefix, userName)
+	slot := uuid.New().String()
+	ok, err := Rdb.Eval(ctx, acquireSlotScript, []string{key},
+		time.Now().UnixMilli(), ttl.Milliseconds(), limit, slot).Int()
+	if err != nil {
+		return "", false, err
+	}
+	return slot, ok == 1, nil
+}
+
+// ReleaseStreamSlot 释放流式输出的并发槽位
+func ReleaseStreamSlot(userName string, slot string) error {
+	key := fmt.Sprintf(config.DefaultRedisKeyConfig.StreamSlotPrefix, userName)
+	return Rdb.ZRem(ctx, key, slot).Err()
+}
+
+// 当天token计数的key，按自然日划分
+func dailyTokenKey(userName string) string {
+	return fmt.Sprintf(config.DefaultRedisKeyConfig.DailyTokenPrefix, userName, time.Now().Format("20060102"))
+}
+
+// AddDailyTokens 累加用户当天消耗的token数
+func AddDailyTokens(userName string, tokens int) error {
+	key := dailyTokenKey(userName)
+	pipe := Rdb.TxPipeline()
+	pipe.IncrBy(ctx, key, int64(tokens))
+	pipe.Expire(ctx, key, 48*time.Hour) //留出余量，跨天后自然过期
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetDailyTokens 获取用户当天已消耗的token数
+func GetDailyTokens(userName string) (int64, error) {
+	n, err := Rdb.Get(ctx, dailyTokenKey(userName)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// GetLimitOverride 获取管理员为用户单独设置的限额（JSON），不存在时返回空字符串
+func GetLimitOverride(userName string) (string, error) {
+	data, err := Rdb.HGet(ctx, config.DefaultRedisKeyConfig.LimitOverrideKey, userName).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return data, err
+}
+
+// SetLimitOverride 设置用户的单独限额
+func SetLimitOverride(userName string, data string) error {
+	return Rdb.HSet(ctx, config.DefaultRedisKeyConfig.LimitOverrideKey, userName, data).Err()
+}
+
+// DeleteLimitOverride 删除用户的单独限额，恢复使用默认配置
+func DeleteLimitOverride(userName string) error {
+	return Rdb.HDel(ctx, config.DefaultRedisKeyConfig.LimitOverrideKey, userName).Err()
+}
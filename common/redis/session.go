@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"GopherAI/config"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//多实例部署时会话的跨实例协调：会话锁、会话版本号、缓存失效通知
+
+// 版本号的过期时间，过期后各实例缓存的会话都会重新加载一次
+const sessionVersionTTL = 24 * time.Hour
+
+// 只有持有者才能续期和释放锁，避免锁过期后被别人获取时误删
+var refreshLockScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+
+var releaseLockScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+func sessionLockKey(sessionID string) string {
+	return fmt.Sprintf(config.DefaultRedisKeyConfig.SessionLockKey, sessionID)
+}
+
+// TryLockSession 尝试获取会话锁，token用于标识持有者
+func TryLockSession(sessionID string, token string, ttl time.Duration) (bool, error) {
+	return Rdb.SetNX(ctx, sessionLockKey(sessionID), token, ttl).Result()
+}
+
+// RefreshSessionLock 续期会话锁，锁已经不属于token时返回false
+func RefreshSessionLock(sessionID string, token string, ttl time.Duration) (bool, error) {
+	n, err := Rdb.Eval(ctx, refreshLockScript, []string{sessionLockKey(sessionID)}, token, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+// UnlockSession 释放会话锁
+func UnlockSession(sessionID string, token string) error {
+	return Rdb.Eval(ctx, releaseLockScript, []string{sessionLockKey(sessionID)}, token).Err()
+}
+
+// GetSessionVersion 获取会话的版本号，从未修改过时为0
+func GetSessionVersion(sessionID string) (int64, error) {
+	v, err := Rdb.Get(ctx, fmt.Sprintf(config.DefaultRedisKeyConfig.SessionVerKey, sessionID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+// IncrSessionVersion 会话被修改后递增版本号，返回新的版本号
+func IncrSessionVersion(sessionID string) (int64, error) {
+	key := fmt.Sprintf(config.DefaultRedisKeyConfig.SessionVerKey, sessionID)
+	pipe := Rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, sessionVersionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// PublishSessionInvalidation 通知其他实例丢弃缓存的会话
+func PublishSessionInvalidation(payload []byte) error {
+	return Rdb.Publish(ctx, config.DefaultRedisKeyConfig.SessionChannel, payload).Err()
+}
+
+// SubscribeSessionInvalidation 在后台订阅缓存失效通知，断线后由客户端自动重连
+func SubscribeSessionInvalidation(handle func(payload string)) {
+	pubsub := Rdb.Subscribe(ctx, config.DefaultRedisKeyConfig.SessionChannel)
+	go func() {
+		for msg := range pubsub.Channel() {
+			handle(msg.Payload)
+		}
+	}()
+}
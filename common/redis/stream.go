@@ -0,0 +1,109 @@
+package redis
+
+import (
+	"GopherAI/config"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//流式输出事件的缓存，连接断开后客户端可以从断点续传
+//每次生成一个Redis Stream，事件序号n作为条目ID（0-n），续传时从客户端收到的最后一个序号之后读取
+//流结束时写入ID为1-0的结束标记，它比所有事件的ID都大
+
+// 结束标记的条目ID
+const streamEndID = "1-0"
+
+// StreamEvent 缓存的一个事件
+type StreamEvent struct {
+	ID      int64
+	Event   string
+	Payload string
+}
+
+func streamKeys(generationID string) (string, string) {
+	return fmt.Sprintf(config.DefaultRedisKeyConfig.StreamEventKey, generationID),
+		fmt.Sprintf(config.DefaultRedisKeyConfig.StreamOwnerKey, generationID)
+}
+
+// StartStreamBuffer 开始缓存一次生成的事件，记录所属的用户和会话，续传时校验
+func StartStreamBuffer(generationID string, userName string, sessionID string, ttl time.Duration) error {
+	_, ownerKey := streamKeys(generationID)
+	pipe := Rdb.Pipeline()
+	pipe.HSet(ctx, ownerKey, "user", userName, "session", sessionID)
+	pipe.Expire(ctx, ownerKey, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetStreamOwner 获取缓存的所属用户和会话，缓存不存在（已过期）时ok为false
+func GetStreamOwner(generationID string) (string, string, bool, error) {
+	_, ownerKey := streamKeys(generationID)
+	values, err := Rdb.HGetAll(ctx, ownerKey).Result()
+	if err != nil {
+		return "", "", false, err
+	}
+	if values["user"] == "" {
+		return "", "", false, nil
+	}
+	return values["user"], values["session"], true, nil
+}
+
+// AppendStreamEvent 缓存一个事件，并刷新过期时间
+func AppendStreamEvent(generationID string, id int64, event string, payload []byte, ttl time.Duration) error {
+	return appendStreamEntry(generationID, "0-"+strconv.FormatInt(id, 10), event, payload, ttl)
+}
+
+// CloseStreamBuffer 写入结束标记，续传读到它时结束
+func CloseStreamBuffer(generationID string, ttl time.Duration) error {
+	return appendStreamEntry(generationID, streamEndID, "", nil, ttl)
+}
+
+func appendStreamEntry(generationID string, entryID string, event string, payload []byte, ttl time.Duration) error {
+	eventKey, ownerKey := streamKeys(generationID)
+	pipe := Rdb.Pipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventKey,
+		ID:     entryID,
+		Values: map[string]interface{}{"event": event, "data": payload},
+	})
+	pipe.Expire(ctx, eventKey, ttl)
+	pipe.Expire(ctx, ownerKey, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ReadStreamEvents 读取序号afterID之后的事件，没有新事件时最多阻塞block；ended表示已经读到结束标记
+func ReadStreamEvents(c context.Context, generationID string, afterID int64, block time.Duration) ([]StreamEvent, bool, error) {
+	eventKey, _ := streamKeys(generationID)
+	res, err := Rdb.XRead(c, &redis.XReadArgs{
+		Streams: []string{eventKey, "0-" + strconv.FormatInt(afterID, 10)},
+		Count:   100,
+		Block:   block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, false, nil //等待超时，没有新事件
+	}
+	if err != nil || len(res) == 0 {
+		return nil, false, err
+	}
+
+	events := make([]StreamEvent, 0, len(res[0].Messages))
+	for _, msg := range res[0].Messages {
+		if msg.ID == streamEndID {
+			return events, true, nil
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(msg.ID, "0-"), 10, 64)
+		if err != nil {
+			return nil, false, err
+		}
+		event, _ := msg.Values["event"].(string)
+		payload, _ := msg.Values["data"].(string)
+		events = append(events, StreamEvent{ID: id, Event: event, Payload: payload})
+	}
+	return events, false, nil
+}
@@ -0,0 +1,225 @@
+package sse //聊天流式输出的SSE事件协议
+
+//每个事件都是具名事件，data为一行JSON（内容中的换行会被转义，不会破坏SSE的分帧）：
+//
+//	id: 3
+//	event: delta
+//	data: {"v":1,"id":3,"messageId":"...","data":{"text":"你好"}}
+//
+//一次生成的事件顺序：session → delta... → usage → done（或error），之后可能还有title
+//设置了Buffer时事件同时写入缓存，连接断开后客户端带上Last-Event-ID从缓存续传
+//WebSocket等其他传输方式通过NewFuncWriter发送同样的事件，生成逻辑不区分传输方式
+import (
+	"GopherAI/common/code"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Version 协议版本，事件格式有不兼容的修改时递增
+const Version = 1
+
+// 事件类型
+const (
+	EventSession = "session" //会话ID和本次生成的ID，流开始时下发
+	EventDelta   = "delta"   //回答的增量内容
+	EventUsage   = "usage"   //本次回答的token用量
+	EventTitle   = "title"   //自动生成的会话标题（在done之后下发）
+	EventError   = "error"   //生成失败，流结束
+	EventDone    = "done"    //生成结束
+)
+
+var ErrStreamingUnsupported = errors.New("streaming unsupported")
+
+// Envelope 所有事件的数据格式
+type Envelope struct {
+	Version   int         `json:"v"`
+	ID        int64       `json:"id"`        //事件序号，同一个流内从1开始递增
+	MessageID string      `json:"messageId"` //事件所属的回复消息，流开始时还没有消息则为空
+	Data      interface{} `json:"data"`
+}
+
+// 各事件的数据
+type (
+	SessionData struct {
+		SessionID    string `json:"sessionId"`
+		GenerationID string `json:"generationId"` //停止生成时带上
+	}
+
+	DeltaData struct {
+		Text string `json:"text"`
+	}
+
+	UsageData struct {
+		ModelID          string `json:"modelId"`
+		PromptTokens     int    `json:"promptTokens"`
+		CompletionTokens int    `json:"completionTokens"`
+		TotalTokens      int    `json:"totalTokens"`
+		LatencyMs        int64  `json:"latencyMs"`
+	}
+
+	TitleData struct {
+		SessionID string `json:"sessionId"`
+		Title     string `json:"title"`
+	}
+
+	ErrorData struct {
+		Code    code.Code `json:"code"`
+		Message string    `json:"message"`
+	}
+
+	DoneData struct {
+		Truncated bool            `json:"truncated"`         //生成被中途停止
+		Sources   json.RawMessage `json:"sources,omitempty"` //回答引用的知识库资料
+	}
+)
+
+// Buffer 事件的缓存
+type Buffer interface {
+	Append(id int64, event string, payload []byte) error
+	Close() error //所有事件已写入
+}
+
+// WriteFunc 按具体的传输方式发送一个事件
+type WriteFunc func(id int64, event string, payload []byte) error
+
+// Writer 按协议写SSE事件，并发安全；done或error之后不再发送error
+type Writer struct {
+	mu       sync.Mutex
+	w        http.ResponseWriter
+	flusher  http.Flusher
+	write    WriteFunc //为nil时写SSE
+	buffer   Buffer
+	lastID   int64
+	finished bool
+	gone     bool //客户端已断开，之后的事件只写入缓存
+}
+
+// NewWriter 设置SSE响应头并创建Writer，writer必须支持Flush
+func NewWriter(w http.ResponseWriter) (*Writer, error) {
+	flusher, ok := w.(http.Flusher) //流式输出必须Flush(),否则数据不会实时推送
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive") //防止断流
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("X-Accel-Buffering", "no") // 禁止代理缓存
+	return &Writer{w: w, flusher: flusher}, nil
+}
+
+// NewFuncWriter 创建通过其他传输方式（如WebSocket）发送事件的Writer
+func NewFuncWriter(write WriteFunc) *Writer {
+	return &Writer{write: write}
+}
+
+// SetBuffer 设置事件缓存，之后发送的事件都会写入缓存
+func (s *Writer) SetBuffer(b Buffer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffer = b
+}
+
+// Close 结束事件流，通知缓存所有事件已写入
+func (s *Writer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buffer != nil {
+		if err := s.buffer.Close(); err != nil {
+			log.Println("[SSE] close buffer error:", err)
+		}
+		s.buffer = nil
+	}
+}
+
+// Send 发送一个事件
+func (s *Writer) Send(event string, messageID string, data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendLocked(event, messageID, data)
+}
+
+// Done 发送生成结束事件
+func (s *Writer) Done(messageID string, data DoneData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished = true
+	return s.sendLocked(EventDone, messageID, data)
+}
+
+// Error 发送错误事件，流已经结束（发送过done或error）时忽略
+func (s *Writer) Error(c code.Code) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return nil
+	}
+	s.finished = true
+	return s.sendLocked(EventError, "", ErrorData{Code: c, Message: c.Msg()})
+}
+
+// Replay 原样转发缓存中的事件（续传），事件序号沿用缓存中的序号
+func (s *Writer) Replay(id int64, event string, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID = id
+	if event == EventDone || event == EventError {
+		s.finished = true
+	}
+	return s.writeLocked(id, event, payload)
+}
+
+// Ping 发送注释行保持连接，避免代理因长时间没有数据断开
+func (s *Writer) Ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.write != nil {
+		return nil //其他传输方式有自己的心跳
+	}
+	if _, err := io.WriteString(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *Writer) sendLocked(event string, messageID string, data interface{}) error {
+	s.lastID++
+	payload, err := json.Marshal(Envelope{Version: Version, ID: s.lastID, MessageID: messageID, Data: data})
+	if err != nil {
+		return err
+	}
+	if s.buffer != nil {
+		if err := s.buffer.Append(s.lastID, event, payload); err != nil {
+			log.Println("[SSE] buffer event error:", err)
+		}
+	}
+	if s.gone {
+		return nil //客户端可以从缓存续传
+	}
+	if err := s.writeLocked(s.lastID, event, payload); err != nil {
+		s.gone = true
+		if s.buffer != nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Writer) writeLocked(id int64, event string, payload []byte) error {
+	if s.write != nil {
+		return s.write(id, event, payload)
+	}
+	if _, err := fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush() //  每次必须 flush
+	return nil
+}
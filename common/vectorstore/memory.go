@@ -0,0 +1,86 @@
+package vectorstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+type memoryEntry struct {
+	record Record
+	norm   float64
+}
+
+// MemoryStore 进程内向量存储，查询时逐条计算余弦相似度
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore 创建进程内向量存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryStore) Upsert(_ context.Context, records []Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range records {
+		m.entries[r.ID] = memoryEntry{record: r, norm: norm(r.Vector)}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.entries, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteByFilter(_ context.Context, filter Filter) (int, error) {
+	if len(filter) == 0 {
+		return 0, ErrEmptyFilter
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, e := range m.entries {
+		if filter.match(e.record.Metadata) {
+			delete(m.entries, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) Query(_ context.Context, vector []float64, topK int, filter Filter) ([]Result, error) {
+	qn := norm(vector)
+	if qn == 0 || topK <= 0 {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	var results []Result
+	for _, e := range m.entries {
+		if e.norm == 0 || len(e.record.Vector) != len(vector) || !filter.match(e.record.Metadata) {
+			continue
+		}
+		results = append(results, Result{Record: e.record, Score: dot(e.record.Vector, vector) / (e.norm * qn)})
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) Count(_ context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entries), nil
+}
@@ -0,0 +1,253 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+const (
+	vectorField  = "vector"
+	contentField = "content"
+	scoreField   = "__score"
+	deleteBatch  = 500
+)
+
+// RedisStore 基于RediSearch的向量存储（需要Redis Stack或加载了search模块的Redis）
+// 每条记录是一个hash：vector为float32小端字节，content为原文，元数据字段建成TAG便于过滤
+type RedisStore struct {
+	client *goredis.Client
+	index  string   //索引名
+	prefix string   //记录的key前缀
+	fields []string //可过滤的元数据字段
+
+	mu      sync.Mutex
+	created bool //索引是否已确认存在
+}
+
+// NewRedisStore 创建Redis向量存储，索引在第一次写入时按向量维度创建
+func NewRedisStore(client *goredis.Client, name string, fields []string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		index:  name + ":idx",
+		prefix: name + ":",
+		fields: fields,
+	}
+}
+
+// 索引不存在时创建
+func (s *RedisStore) ensureIndex(ctx context.Context, dim int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created {
+		return nil
+	}
+
+	args := []interface{}{"FT.CREATE", s.index, "ON", "HASH", "PREFIX", 1, s.prefix, "SCHEMA",
+		vectorField, "VECTOR", "HNSW", 6, "TYPE", "FLOAT32", "DIM", dim, "DISTANCE_METRIC", "COSINE"}
+	for _, f := range s.fields {
+		args = append(args, f, "TAG")
+	}
+	if err := s.client.Do(ctx, args...).Err(); err != nil && !strings.Contains(err.Error(), "Index already exists") {
+		return fmt.Errorf("vectorstore: create index failed: %w", err)
+	}
+	s.created = true
+	return nil
+}
+
+func (s *RedisStore) Upsert(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.ensureIndex(ctx, len(records[0].Vector)); err != nil {
+		return err
+	}
+
+	pipe := s.client.Pipeline()
+	for _, r := range records {
+		values := map[string]interface{}{
+			vectorField:  encodeVector(r.Vector),
+			contentField: r.Content,
+		}
+		for k, v := range r.Metadata {
+			values[k] = v
+		}
+		key := s.prefix + r.ID
+		pipe.Del(ctx, key) //覆盖时清掉旧的元数据字段
+		pipe.HSet(ctx, key, values)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, s.prefix+id)
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+func (s *RedisStore) DeleteByFilter(ctx context.Context, filter Filter) (int, error) {
+	if len(filter) == 0 {
+		return 0, ErrEmptyFilter
+	}
+	total := 0
+	for {
+		reply, err := s.client.Do(ctx, "FT.SEARCH", s.index, filterQuery(filter), "NOCONTENT", "LIMIT", 0, deleteBatch, "DIALECT", 2).Result()
+		if err != nil {
+			if isUnknownIndex(err) {
+				return total, nil
+			}
+			return total, err
+		}
+		rows, ok := reply.([]interface{})
+		if !ok || len(rows) <= 1 {
+			return total, nil
+		}
+		keys := make([]string, 0, len(rows)-1)
+		for _, row := range rows[1:] {
+			keys = append(keys, fmt.Sprint(row))
+		}
+		if err := s.client.Del(ctx, keys...).Err(); err != nil {
+			return total, err
+		}
+		total += len(keys)
+	}
+}
+
+func (s *RedisStore) Query(ctx context.Context, vector []float64, topK int, filter Filter) ([]Result, error) {
+	if topK <= 0 || len(vector) == 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("%s=>[KNN %d @%s $vec AS %s]", filterQuery(filter), topK, vectorField, scoreField)
+	args := []interface{}{"FT.SEARCH", s.index, query, "PARAMS", 2, "vec", encodeVector(vector),
+		"SORTBY", scoreField, "ASC", "LIMIT", 0, topK, "RETURN", 2 + len(s.fields), contentField, scoreField}
+	for _, f := range s.fields {
+		args = append(args, f)
+	}
+	args = append(args, "DIALECT", 2)
+
+	reply, err := s.client.Do(ctx, args...).Result()
+	if err != nil {
+		if isUnknownIndex(err) {
+			return nil, nil //还没有写入过数据
+		}
+		return nil, err
+	}
+	return s.parseResults(reply)
+}
+
+// 解析FT.SEARCH的返回：[总数, key1, [field, value, ...], key2, [...], ...]
+func (s *RedisStore) parseResults(reply interface{}) ([]Result, error) {
+	rows, ok := reply.([]interface{})
+	if !ok || len(rows) == 0 {
+		return nil, errors.New("vectorstore: unexpected search reply")
+	}
+
+	var results []Result
+	for i := 1; i+1 < len(rows); i += 2 {
+		key := fmt.Sprint(rows[i])
+		fields, _ := rows[i+1].([]interface{})
+		r := Result{Record: Record{ID: strings.TrimPrefix(key, s.prefix), Metadata: make(map[string]string)}}
+		for j := 0; j+1 < len(fields); j += 2 {
+			name, value := fmt.Sprint(fields[j]), fmt.Sprint(fields[j+1])
+			switch name {
+			case contentField:
+				r.Content = value
+			case scoreField:
+				distance, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("vectorstore: invalid score %q", value)
+				}
+				r.Score = 1 - distance //余弦距离转成相似度
+			default:
+				r.Metadata[name] = value
+			}
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
+
+func (s *RedisStore) Count(ctx context.Context) (int, error) {
+	reply, err := s.client.Do(ctx, "FT.INFO", s.index).Result()
+	if err != nil {
+		if isUnknownIndex(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	items, _ := reply.([]interface{})
+	for i := 0; i+1 < len(items); i += 2 {
+		if fmt.Sprint(items[i]) == "num_docs" {
+			return strconv.Atoi(fmt.Sprint(items[i+1]))
+		}
+	}
+	return 0, errors.New("vectorstore: num_docs not found in FT.INFO")
+}
+
+// 把过滤条件转换成RediSearch查询，例如 (@kb:{1|2} @doc:{3})
+func filterQuery(filter Filter) string {
+	fields := make([]string, 0, len(filter))
+	for field := range filter {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var parts []string
+	for _, field := range fields {
+		values := filter[field]
+		if len(values) == 0 {
+			continue
+		}
+		escaped := make([]string, 0, len(values))
+		for _, v := range values {
+			escaped = append(escaped, escapeTag(v))
+		}
+		parts = append(parts, fmt.Sprintf("@%s:{%s}", field, strings.Join(escaped, "|")))
+	}
+	if len(parts) == 0 {
+		return "*"
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// TAG值中的标点和空格需要转义
+func escapeTag(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isUnknownIndex(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unknown index") || strings.Contains(msg, "no such index")
+}
+
+// 向量编码成float32小端字节
+func encodeVector(v []float64) string {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(f)))
+	}
+	return string(buf)
+}
@@ -0,0 +1,119 @@
+package vectorstore //向量存储
+
+//1.统一向量的写入、删除和k近邻检索
+//2.memory：进程内暴力检索，适合开发和单机部署
+//3.redis：基于RediSearch的向量索引，多个实例共享同一份数据
+import (
+	"GopherAI/common/redis"
+	"GopherAI/config"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Record 一条向量记录，Metadata用于检索时过滤
+type Record struct {
+	ID       string
+	Vector   []float64
+	Content  string
+	Metadata map[string]string
+}
+
+// Result 检索结果，Score为余弦相似度（越大越相似）
+type Result struct {
+	Record
+	Score float64
+}
+
+// Filter 元数据过滤条件：字段 -> 可选值，同一字段内任意一个值匹配即可，不同字段之间需同时满足
+type Filter map[string][]string
+
+// VectorStore 向量存储接口
+type VectorStore interface {
+	// Upsert 写入记录，ID已存在时覆盖
+	Upsert(ctx context.Context, records []Record) error
+	// Delete 按ID删除
+	Delete(ctx context.Context, ids []string) error
+	// DeleteByFilter 删除满足过滤条件的所有记录，返回删除的条数
+	DeleteByFilter(ctx context.Context, filter Filter) (int, error)
+	// Query 在满足过滤条件的记录中检索与vector最相似的topK条
+	Query(ctx context.Context, vector []float64, topK int, filter Filter) ([]Result, error)
+	// Count 记录总数
+	Count(ctx context.Context) (int, error)
+}
+
+// ErrEmptyFilter 按条件删除时必须指定条件，避免误删全部数据
+var ErrEmptyFilter = errors.New("vectorstore: empty filter")
+
+var (
+	stores   = make(map[string]VectorStore)
+	storesMu sync.Mutex
+)
+
+// Get 获取（懒加载）指定名字的向量存储，后端由配置决定
+// fields为需要支持过滤的元数据字段，redis后端建索引时用到
+func Get(name string, fields []string) (VectorStore, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if store, ok := stores[name]; ok {
+		return store, nil
+	}
+
+	conf := config.GetConfig().VectorStoreConfig
+	var store VectorStore
+	switch conf.Backend {
+	case "memory", "":
+		store = NewMemoryStore()
+	case "redis":
+		if redis.Rdb == nil {
+			return nil, errors.New("vectorstore: redis is not initialized")
+		}
+		prefix := conf.KeyPrefix
+		if prefix == "" {
+			prefix = "vector"
+		}
+		store = NewRedisStore(redis.Rdb, prefix+":"+name, fields)
+	default:
+		return nil, fmt.Errorf("vectorstore: unknown backend %s", conf.Backend)
+	}
+	stores[name] = store
+	return store, nil
+}
+
+// 记录是否满足过滤条件
+func (f Filter) match(metadata map[string]string) bool {
+	for field, values := range f {
+		if len(values) == 0 {
+			continue
+		}
+		v, ok := metadata[field]
+		if !ok {
+			return false
+		}
+		matched := false
+		for _, want := range values {
+			if v == want {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func dot(a, b []float64) float64 {
+	var s float64
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func norm(v []float64) float64 {
+	return math.Sqrt(dot(v, v))
+}
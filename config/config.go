@@ -17,6 +17,8 @@ type MainConfig struct {
 	Port    int    `toml:"port"`
 	AppName string `toml:"appName"`
 	Host    string `toml:"host"`
+	//除同源外允许建立WebSocket连接的来源（例如前端开发服务器），完整匹配Origin请求头
+	AllowedOrigins []string `toml:"allowedOrigins"`
 }
 
 //`toml:"port"`等类似的内容成为结构体标签，Go编译器不会解释他的含义，他的含义由使用反射的库（toml库）来定义
@@ -60,21 +62,162 @@ type Rabbitmq struct {
 	RabbitmqVhost    string `toml:"vhost"`
 } //消息队列配置
 
+type ContextConfig struct {
+	MaxContextTokens int `toml:"maxContextTokens"` //模型上下文窗口大小（token）
+	ReserveTokens    int `toml:"reserveTokens"`    //给模型回复预留的token数
+} //上下文窗口配置
+
+type SummaryConfig struct {
+	Enabled       bool   `toml:"enabled"`       //是否开启滚动摘要
+	ModelType     string `toml:"modelType"`     //用于生成摘要的模型（可以用更便宜的模型）
+	TriggerTokens int    `toml:"triggerTokens"` //未摘要部分超过该token数时触发摘要
+} //会话滚动摘要配置
+
+type TitleConfig struct {
+	Enabled        bool   `toml:"enabled"`        //是否在第一轮对话后自动生成会话标题
+	ModelType      string `toml:"modelType"`      //用于生成标题的模型（可以用更便宜的模型），不填使用默认模型
+	MaxLength      int    `toml:"maxLength"`      //标题的最大字数
+	TimeoutSeconds int    `toml:"timeoutSeconds"` //生成标题的超时时间，流式接口最多等待这么久再下发标题
+} //会话标题自动生成配置
+
+type ModelConfig struct {
+	ID               string   `toml:"id"`          //模型标识，前端通过它选择模型（即modelType）
+	Name             string   `toml:"name"`        //展示给前端的名称
+	Provider         string   `toml:"provider"`    //模型提供方：openai（及兼容OpenAI协议的厂商）/ ollama
+	BaseURL          string   `toml:"baseURL"`     //接口地址
+	ModelName        string   `toml:"modelName"`   //厂商侧的模型名
+	APIKeyEnv        string   `toml:"apiKeyEnv"`   //从哪个环境变量读取API Key，避免把密钥写进配置文件
+	Temperature      *float32 `toml:"temperature"` //以下为默认生成参数，不填使用厂商默认值
+	TopP             *float32 `toml:"topP"`
+	MaxTokens        int      `toml:"maxTokens"`
+	MaxContextTokens int      `toml:"maxContextTokens"` //上下文窗口大小，不填使用contextConfig中的值
+	Vision           bool     `toml:"vision"`           //是否支持图片输入，不支持时图片以文字提示代替
+	Fallbacks        []string `toml:"fallbacks"`        //provider为failover时，按顺序尝试的模型id列表
+} //模型配置，每个[[models]]对应一个可选模型
+
+type FailoverConfig struct {
+	MaxRetries             int `toml:"maxRetries"`             //单个后端的最大重试次数，0使用默认值，小于0不重试
+	InitialBackoffMs       int `toml:"initialBackoffMs"`       //首次重试前的等待时间，之后每次翻倍
+	MaxBackoffMs           int `toml:"maxBackoffMs"`           //重试等待时间上限
+	BreakerThreshold       int `toml:"breakerThreshold"`       //连续失败多少次后熔断
+	BreakerCooldownSeconds int `toml:"breakerCooldownSeconds"` //熔断后多久允许再次尝试
+} //模型故障转移配置
+
+type ModelPrice struct {
+	PromptPer1K     float64 `toml:"promptPer1K"`     //每千个输入token的价格
+	CompletionPer1K float64 `toml:"completionPer1K"` //每千个输出token的价格
+} //模型单价
+
+type RateLimitConfig struct {
+	Enabled              bool     `toml:"enabled"`              //是否开启限流
+	RequestsPerMinute    int      `toml:"requestsPerMinute"`    //每个用户每分钟最多请求次数，0表示不限制
+	MaxConcurrentStreams int      `toml:"maxConcurrentStreams"` //每个用户同时进行的流式输出数，0表示不限制
+	DailyTokens          int64    `toml:"dailyTokens"`          //每个用户每天的token额度，0表示不限制
+	Admins               []string `toml:"admins"`               //可以调整他人限额的管理员用户名
+} //限流与额度配置
+
+type EmbeddingConfig struct {
+	Provider  string `toml:"provider"`  //向量模型提供方：openai（及兼容OpenAI协议的厂商）/ ollama
+	BaseURL   string `toml:"baseURL"`   //接口地址
+	ModelName string `toml:"modelName"` //向量模型名
+	APIKeyEnv string `toml:"apiKeyEnv"` //从哪个环境变量读取API Key
+	BatchSize int    `toml:"batchSize"` //每次请求向量化的文本条数
+} //文本向量化配置
+
+type RAGConfig struct {
+	ChunkSize     int     `toml:"chunkSize"`     //文档切片的最大字符数
+	ChunkOverlap  int     `toml:"chunkOverlap"`  //相邻切片重叠的字符数
+	TopK          int     `toml:"topK"`          //每次检索返回的切片数
+	MinScore      float64 `toml:"minScore"`      //相似度低于该值的切片不使用
+	MaxFileSizeMB int     `toml:"maxFileSizeMB"` //上传文档的大小上限
+} //知识库检索配置
+
+type VectorStoreConfig struct {
+	Backend   string `toml:"backend"`   //向量存储：memory（进程内，单机/开发用）/ redis（需要RediSearch模块，多实例共享）
+	KeyPrefix string `toml:"keyPrefix"` //redis后端的key和索引名前缀
+} //向量存储配置
+
+type AttachmentConfig struct {
+	Dir          string `toml:"dir"`          //图片保存目录
+	MaxSizeMB    int    `toml:"maxSizeMB"`    //单张图片大小上限
+	MaxCount     int    `toml:"maxCount"`     //一条消息最多附带的图片数
+	ClassifyHint bool   `toml:"classifyHint"` //上传时用本地ONNX模型分类，结果作为看不了图片的模型的提示
+} //聊天图片配置
+
+type SessionCacheConfig struct {
+	MaxHelpers  int `toml:"maxHelpers"`  //内存中最多保留的会话数，超出时淘汰最久未使用的，0表示不限制
+	IdleMinutes int `toml:"idleMinutes"` //会话空闲超过该分钟数后从内存中淘汰，0表示不按时间淘汰
+	//同一会话上一轮对话未结束时，新请求排队等待的秒数，超时返回会话忙，0表示直接返回
+	TurnWaitSeconds int `toml:"turnWaitSeconds"`
+} //会话内存缓存配置（会话在首次访问时从数据库加载）
+
+type StreamBufferConfig struct {
+	Enabled    bool `toml:"enabled"`    //为true时流式输出的事件缓存在Redis中，连接断开后可以续传
+	TTLSeconds int  `toml:"ttlSeconds"` //缓存的过期时间（秒），从最后一次写入开始计算
+} //流式输出续传配置
+
+type ClusterConfig struct {
+	Enabled         bool `toml:"enabled"`         //多实例部署时开启：修改会话前获取Redis锁，修改后通过Redis发布订阅通知其他实例
+	LockTTLSeconds  int  `toml:"lockTtlSeconds"`  //会话锁的过期时间（秒），持有期间自动续期，实例崩溃后最多这么久释放
+	LockWaitSeconds int  `toml:"lockWaitSeconds"` //获取会话锁的最长等待时间（秒），超时返回会话忙
+} //多实例部署配置
+
+type SearchConfig struct {
+	Semantic             bool    `toml:"semantic"`             //是否开启语义搜索（后台把消息向量化写入向量存储，使用embeddingConfig）
+	IndexBatch           int     `toml:"indexBatch"`           //每批向量化的消息条数
+	IndexIntervalSeconds int     `toml:"indexIntervalSeconds"` //没有新消息时多久检查一次
+	MinScore             float64 `toml:"minScore"`             //语义搜索相似度低于该值的消息不返回
+} //聊天记录搜索配置
+
 type Config struct {
-	EmailConfig `toml:"emailConfig"`
-	RedisConfig `toml:"redisConfig"`
-	MysqlConfig `toml:"mysqlConfig"`
-	JwtConfig   `toml:"jwtConfig"`
-	MainConfig  `toml:"mainConfig"`
-	Rabbitmq    `toml:"rabbitmqConfig"`
+	EmailConfig        `toml:"emailConfig"`
+	RedisConfig        `toml:"redisConfig"`
+	MysqlConfig        `toml:"mysqlConfig"`
+	JwtConfig          `toml:"jwtConfig"`
+	MainConfig         `toml:"mainConfig"`
+	Rabbitmq           `toml:"rabbitmqConfig"`
+	ContextConfig      `toml:"contextConfig"`
+	SummaryConfig      `toml:"summaryConfig"`
+	TitleConfig        `toml:"titleConfig"`
+	FailoverConfig     `toml:"failoverConfig"`
+	RateLimitConfig    `toml:"rateLimitConfig"`
+	EmbeddingConfig    `toml:"embeddingConfig"`
+	RAGConfig          `toml:"ragConfig"`
+	VectorStoreConfig  `toml:"vectorStoreConfig"`
+	AttachmentConfig   `toml:"attachmentConfig"`
+	SessionCacheConfig `toml:"sessionCacheConfig"`
+	StreamBufferConfig `toml:"streamBufferConfig"`
+	ClusterConfig      `toml:"clusterConfig"`
+	SearchConfig       `toml:"searchConfig"`
+	Models             []ModelConfig         `toml:"models"`
+	Currency           string                `toml:"currency"` //计费币种，仅用于展示
+	Pricing            map[string]ModelPrice `toml:"pricing"`  //按模型id配置的价格表
 } //结构体嵌套，子结构体Config可以直接使用父结构体的字段和方法
 
 type RedisKeyConfig struct {
-	CaptchaPrefix string
+	CaptchaPrefix    string
+	RateLimitPrefix  string
+	StreamSlotPrefix string
+	DailyTokenPrefix string
+	LimitOverrideKey string
+	StreamEventKey   string
+	StreamOwnerKey   string
+	SessionLockKey   string
+	SessionVerKey    string
+	SessionChannel   string
 }
 
 var DefaultRedisKeyConfig = RedisKeyConfig{
-	CaptchaPrefix: "captcha:%s",
+	CaptchaPrefix:    "captcha:%s",
+	RateLimitPrefix:  "ratelimit:rpm:%s",
+	StreamSlotPrefix: "ratelimit:streams:%s",
+	DailyTokenPrefix: "ratelimit:tokens:%s:%s",
+	LimitOverrideKey: "ratelimit:overrides",
+	StreamEventKey:   "stream:%s:events",
+	StreamOwnerKey:   "stream:%s:owner",
+	SessionLockKey:   "session:%s:lock",
+	SessionVerKey:    "session:%s:version",
+	SessionChannel:   "sessions:invalidate",
 }
 
 var config *Config
@@ -102,3 +245,31 @@ func GetConfig() *Config {
 	}
 	return config
 } //获取配置好的文件（先创建，后初始化）
+
+// GetModelConfig 根据模型标识查找模型配置
+func (c *Config) GetModelConfig(id string) (*ModelConfig, bool) {
+	for i := range c.Models {
+		if c.Models[i].ID == id {
+			return &c.Models[i], true
+		}
+	}
+	return nil, false
+}
+
+// IsAdmin 判断用户是否为管理员
+func (c *Config) IsAdmin(userName string) bool {
+	for _, admin := range c.Admins {
+		if admin == userName {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultModelType 默认模型（配置中的第一个模型）
+func (c *Config) DefaultModelType() string {
+	if len(c.Models) == 0 {
+		return ""
+	}
+	return c.Models[0].ID
+}
@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/ratelimit"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	UserLimitResponse struct {
+		UserName    string               `json:"userName"`
+		Limit       model.UserLimit      `json:"limit"`              // 实际生效的限额
+		Override    *model.LimitOverride `json:"override,omitempty"` // 单独设置的限额
+		TokensToday int64                `json:"tokensToday"`        // 今天已消耗的token
+		controller.Response
+	} //响应体（用户限额）
+)
+
+func GetUserLimit(c *gin.Context) {
+	res := new(UserLimitResponse)
+	userName := c.Param("userName")
+
+	limit, override, used, code_ := ratelimit.GetUserLimit(userName)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.UserName = userName
+	res.Limit = limit
+	res.Override = override
+	res.TokensToday = used
+	c.JSON(http.StatusOK, res)
+} //查询用户限额
+
+func SetUserLimit(c *gin.Context) {
+	req := new(model.LimitOverride)
+	res := new(controller.Response)
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	code_ := ratelimit.SetUserLimit(c.Param("userName"), req)
+	c.JSON(http.StatusOK, res.CodeOf(code_))
+} //为用户单独设置限额
+
+func DeleteUserLimit(c *gin.Context) {
+	res := new(controller.Response)
+	code_ := ratelimit.DeleteUserLimit(c.Param("userName"))
+	c.JSON(http.StatusOK, res.CodeOf(code_))
+} //恢复用户的默认限额
@@ -0,0 +1,24 @@
+package aimodel
+
+import (
+	"GopherAI/common/aihelper"
+	"GopherAI/controller"
+	"GopherAI/service/aimodel"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	ListModelsResponse struct {
+		Models []aihelper.ModelInfo `json:"models"`
+		controller.Response
+	} //响应体（可用模型列表，第一个为默认模型）
+)
+
+func ListModels(c *gin.Context) {
+	res := new(ListModelsResponse)
+	res.Success()
+	res.Models = aimodel.ListModels()
+	c.JSON(http.StatusOK, res)
+} //获取可用模型列表
@@ -0,0 +1,61 @@
+package attachment
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/attachment"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	UploadAttachmentResponse struct {
+		Attachment *model.Attachment `json:"attachment,omitempty"`
+		controller.Response
+	} //响应体（上传聊天图片）
+)
+
+func UploadAttachment(c *gin.Context) {
+	res := new(UploadAttachmentResponse)
+	userName := c.GetString("userName") // From JWT middleware
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeServerBusy))
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeServerBusy))
+		return
+	}
+
+	att, code_ := attachment.UploadAttachment(userName, file.Filename, data)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Attachment = att
+	c.JSON(http.StatusOK, res)
+} //上传聊天图片（multipart表单字段image），发送消息时通过attachmentIds引用
+
+func GetAttachment(c *gin.Context) {
+	userName := c.GetString("userName")
+	att, data, code_ := attachment.GetAttachment(userName, c.Param("id"))
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, new(controller.Response).CodeOf(code_))
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, att.MIMEType, data)
+} //获取聊天图片内容
@@ -0,0 +1,211 @@
+package knowledge
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/knowledge"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	KnowledgeBaseRequest struct {
+		Name        string `json:"name" binding:"required,max=50"`
+		Description string `json:"description" binding:"max=255"`
+	} //请求体（创建知识库）
+
+	KnowledgeBaseResponse struct {
+		KnowledgeBase *model.KnowledgeBase `json:"knowledgeBase,omitempty"`
+		controller.Response
+	} //响应体（单个知识库）
+
+	KnowledgeBaseListResponse struct {
+		KnowledgeBases []model.KnowledgeBase `json:"knowledgeBases"`
+		controller.Response
+	} //响应体（知识库列表）
+
+	DocumentResponse struct {
+		Document *model.Document `json:"document,omitempty"`
+		controller.Response
+	} //响应体（上传文档）
+
+	DocumentListResponse struct {
+		Documents []model.Document `json:"documents"`
+		controller.Response
+	} //响应体（文档列表）
+
+	SessionKnowledgeBasesRequest struct {
+		KnowledgeBaseIDs []uint `json:"knowledgeBaseIds"` // 为空表示不再使用知识库
+	} //请求体（设置会话挂载的知识库）
+
+	SessionKnowledgeBasesResponse struct {
+		KnowledgeBaseIDs []uint `json:"knowledgeBaseIds"`
+		controller.Response
+	} //响应体（会话挂载的知识库）
+)
+
+// 解析路径中的ID
+func parseID(c *gin.Context, key string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(key), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func ListKnowledgeBases(c *gin.Context) {
+	res := new(KnowledgeBaseListResponse)
+	userName := c.GetString("userName") // From JWT middleware
+
+	kbs, code_ := knowledge.GetKnowledgeBases(userName)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.KnowledgeBases = kbs
+	c.JSON(http.StatusOK, res)
+} //获取用户所有知识库
+
+func CreateKnowledgeBase(c *gin.Context) {
+	req := new(KnowledgeBaseRequest)
+	res := new(KnowledgeBaseResponse)
+	userName := c.GetString("userName")
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	kb, code_ := knowledge.CreateKnowledgeBase(userName, req.Name, req.Description)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.KnowledgeBase = kb
+	c.JSON(http.StatusOK, res)
+} //创建知识库
+
+func DeleteKnowledgeBase(c *gin.Context) {
+	res := new(controller.Response)
+	userName := c.GetString("userName")
+	id, ok := parseID(c, "id")
+	if !ok {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	code_ := knowledge.DeleteKnowledgeBase(userName, id)
+	c.JSON(http.StatusOK, res.CodeOf(code_))
+} //删除知识库及其所有文档
+
+func ListDocuments(c *gin.Context) {
+	res := new(DocumentListResponse)
+	userName := c.GetString("userName")
+	id, ok := parseID(c, "id")
+	if !ok {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	docs, code_ := knowledge.GetDocuments(userName, id)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Documents = docs
+	c.JSON(http.StatusOK, res)
+} //获取知识库中的文档及处理状态
+
+func UploadDocument(c *gin.Context) {
+	res := new(DocumentResponse)
+	userName := c.GetString("userName")
+	id, ok := parseID(c, "id")
+	if !ok {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeServerBusy))
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeServerBusy))
+		return
+	}
+
+	doc, code_ := knowledge.UploadDocument(userName, id, file.Filename, data)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Document = doc
+	c.JSON(http.StatusOK, res)
+} //上传文档（multipart表单字段file），后台异步解析和向量化
+
+func DeleteDocument(c *gin.Context) {
+	res := new(controller.Response)
+	userName := c.GetString("userName")
+	id, ok := parseID(c, "id")
+	docID, ok2 := parseID(c, "docId")
+	if !ok || !ok2 {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	code_ := knowledge.DeleteDocument(userName, id, docID)
+	c.JSON(http.StatusOK, res.CodeOf(code_))
+} //删除文档
+
+func GetSessionKnowledgeBases(c *gin.Context) {
+	res := new(SessionKnowledgeBasesResponse)
+	userName := c.GetString("userName")
+
+	ids, code_ := knowledge.GetSessionKnowledgeBases(userName, c.Param("id"))
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.KnowledgeBaseIDs = ids
+	c.JSON(http.StatusOK, res)
+} //获取会话挂载的知识库
+
+func SetSessionKnowledgeBases(c *gin.Context) {
+	req := new(SessionKnowledgeBasesRequest)
+	res := new(SessionKnowledgeBasesResponse)
+	userName := c.GetString("userName")
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	code_ := knowledge.SetSessionKnowledgeBases(userName, c.Param("id"), req.KnowledgeBaseIDs)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.KnowledgeBaseIDs = req.KnowledgeBaseIDs
+	c.JSON(http.StatusOK, res)
+} //设置会话挂载的知识库（整体替换）
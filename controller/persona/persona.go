@@ -0,0 +1,148 @@
+package persona
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/persona"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	PersonaRequest struct {
+		Name         string   `json:"name" binding:"required"`
+		SystemPrompt string   `json:"systemPrompt" binding:"required"`
+		ModelType    string   `json:"modelType"`
+		Temperature  *float32 `json:"temperature,omitempty"`
+	} //请求体（创建/修改人设）
+
+	PersonaResponse struct {
+		Persona *model.Persona `json:"persona,omitempty"`
+		controller.Response
+	} //响应体（单个人设）
+
+	PersonaListResponse struct {
+		Personas []model.Persona `json:"personas"`
+		controller.Response
+	} //响应体（人设列表）
+)
+
+// 解析路径中的人设ID
+func parseID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (r *PersonaRequest) toModel() *model.Persona {
+	return &model.Persona{
+		Name:         r.Name,
+		SystemPrompt: r.SystemPrompt,
+		ModelType:    r.ModelType,
+		Temperature:  r.Temperature,
+	}
+}
+
+func ListPersonas(c *gin.Context) {
+	res := new(PersonaListResponse)
+	userName := c.GetString("userName") // From JWT middleware
+
+	personas, code_ := persona.GetPersonas(userName)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Personas = personas
+	c.JSON(http.StatusOK, res)
+} //获取用户所有人设
+
+func GetPersona(c *gin.Context) {
+	res := new(PersonaResponse)
+	userName := c.GetString("userName")
+	id, ok := parseID(c)
+	if !ok {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	p, code_ := persona.GetPersona(userName, id)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Persona = p
+	c.JSON(http.StatusOK, res)
+} //获取单个人设
+
+func CreatePersona(c *gin.Context) {
+	req := new(PersonaRequest)
+	res := new(PersonaResponse)
+	userName := c.GetString("userName")
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	p, code_ := persona.CreatePersona(userName, req.toModel())
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Persona = p
+	c.JSON(http.StatusOK, res)
+} //创建人设
+
+func UpdatePersona(c *gin.Context) {
+	req := new(PersonaRequest)
+	res := new(PersonaResponse)
+	userName := c.GetString("userName")
+	id, ok := parseID(c)
+	if !ok {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	p, code_ := persona.UpdatePersona(userName, id, req.toModel())
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Persona = p
+	c.JSON(http.StatusOK, res)
+} //修改人设
+
+func DeletePersona(c *gin.Context) {
+	res := new(controller.Response)
+	userName := c.GetString("userName")
+	id, ok := parseID(c)
+	if !ok {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	code_ := persona.DeletePersona(userName, id)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	c.JSON(http.StatusOK, res)
+} //删除人设
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/search"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	SearchRequest struct {
+		Query     string `form:"q" binding:"required"` // 搜索内容，多个关键词用空格分隔
+		Mode      string `form:"mode"`                 // keyword（默认）/ semantic / hybrid
+		From      string `form:"from"`                 // 开始日期，格式2006-01-02
+		To        string `form:"to"`                   // 结束日期（包含当天）
+		ModelID   string `form:"model"`                // 只搜索该模型的回答
+		SessionID string `form:"sessionId"`            // 只搜索该会话
+		Limit     int    `form:"limit"`                // 每页条数，默认20，最大50
+		Offset    int    `form:"offset"`
+	} //请求体（搜索聊天记录）
+
+	SearchResponse struct {
+		Results []model.SearchResult `json:"results"`
+		controller.Response
+	} //响应体（搜索聊天记录）
+)
+
+func Search(c *gin.Context) {
+	req := new(SearchRequest)
+	res := new(SearchResponse)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	results, code_ := search.Search(c.Request.Context(), userName, &search.Request{
+		Query:     req.Query,
+		Mode:      req.Mode,
+		From:      req.From,
+		To:        req.To,
+		ModelID:   req.ModelID,
+		SessionID: req.SessionID,
+		Limit:     req.Limit,
+		Offset:    req.Offset,
+	})
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Results = results
+	c.JSON(http.StatusOK, res)
+} //搜索聊天记录，结果带高亮片段和所在会话、消息
@@ -1,44 +1,102 @@
 package session
 
 import (
+	"GopherAI/common/aihelper"
 	"GopherAI/common/code"
+	"GopherAI/common/sse"
 	"GopherAI/controller"
 	"GopherAI/model"
 	"GopherAI/service/session"
-	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type (
+	GetUserSessionsRequest struct {
+		Archived bool   `form:"archived"` // true时列出归档的会话
+		Deleted  bool   `form:"deleted"`  // true时列出已删除（可恢复）的会话
+		Sort     string `form:"sort"`     // 排序：updated（默认，按最近活跃）/ created
+		Limit    int    `form:"limit"`    // 每页条数，默认20，最大100
+		Cursor   string `form:"cursor"`   // 上一页返回的nextCursor
+	} //请求体（获取用户会话列表）
 	GetUserSessionsResponse struct {
 		controller.Response
-		Sessions []model.SessionInfo `json:"sessions,omitempty"`
+		Sessions   []model.SessionInfo `json:"sessions,omitempty"`
+		NextCursor string              `json:"nextCursor,omitempty"` // 为空表示没有更多
 		//omitempty:如果为空切片，不返回该字段
 	} //响应体（获取用户会话列表）
 	CreateSessionAndSendMessageRequest struct {
-		UserQuestion string `json:"question" binding:"required"`  // 用户问题;
-		ModelType    string `json:"modelType" binding:"required"` // 模型类型;
+		UserQuestion     string   `json:"question" binding:"required"` // 用户问题;
+		ModelType        string   `json:"modelType"`                   // 模型类型（指定了人设时可不传，使用人设的默认模型）;
+		PersonaID        uint     `json:"personaId,omitempty"`         // 人设ID（可选）;
+		KnowledgeBaseIDs []uint   `json:"knowledgeBaseIds,omitempty"`  // 挂载的知识库（可选）;
+		AttachmentIDs    []string `json:"attachmentIds,omitempty"`     // 附带的图片（先通过上传接口获得ID）;
 	} //请求体（创建会话并发送消息）
 	CreateSessionAndSendMessageResponse struct {
-		AiInformation string `json:"Information,omitempty"` // AI回答
-		SessionID     string `json:"sessionId,omitempty"`   // 当前会话ID
+		AiInformation string         `json:"Information,omitempty"` // AI回答
+		SessionID     string         `json:"sessionId,omitempty"`   // 当前会话ID
+		Sources       []model.Source `json:"sources,omitempty"`     // 回答引用的知识库资料
 		controller.Response
 	} //响应体（创建会话并发送消息）
 
 	ChatSendRequest struct {
-		UserQuestion string `json:"question" binding:"required"`            // 用户问题;
-		ModelType    string `json:"modelType" binding:"required"`           // 模型类型;
-		SessionID    string `json:"sessionId,omitempty" binding:"required"` // 当前会话ID
+		UserQuestion  string   `json:"question" binding:"required"`            // 用户问题;
+		ModelType     string   `json:"modelType,omitempty"`                    // 已废弃，可不传：会话使用自己保存的模型（通过会话配置接口修改），只在升级前没有记录模型的会话上生效;
+		SessionID     string   `json:"sessionId,omitempty" binding:"required"` // 当前会话ID
+		AttachmentIDs []string `json:"attachmentIds,omitempty"`                // 附带的图片（先通过上传接口获得ID）;
 		//binding...JSON可不返回，但请求中必须传
 	} //请求体（继续聊天）
 
 	ChatSendResponse struct {
-		AiInformation string `json:"Information,omitempty"` // AI回答
+		AiInformation string         `json:"Information,omitempty"` // AI回答
+		Sources       []model.Source `json:"sources,omitempty"`     // 回答引用的知识库资料
 		controller.Response
 	} //响应体（继续聊天）
 
+	RegenerateRequest struct {
+		SessionID string `json:"sessionId" binding:"required"` // 当前会话ID
+		ModelType string `json:"modelType"`                    // 模型类型;
+	} //请求体（重新生成最后一次回答）
+
+	EditMessageRequest struct {
+		SessionID    string `json:"sessionId" binding:"required"` // 当前会话ID
+		MessageID    string `json:"messageId" binding:"required"` // 要修改的用户消息ID
+		UserQuestion string `json:"question" binding:"required"`  // 修改后的问题
+		ModelType    string `json:"modelType"`                    // 模型类型;
+	} //请求体（修改问题并重新发送）
+
+	SwitchBranchRequest struct {
+		SessionID string `json:"sessionId" binding:"required"` // 当前会话ID
+		MessageID string `json:"messageId" binding:"required"` // 切换到的消息（历史中sibling_ids里的某一个）
+	} //请求体（切换分支）
+
+	StopGenerationRequest struct {
+		GenerationID string `json:"generationId,omitempty"` // 要停止的生成ID（流式接口开头下发）
+		SessionID    string `json:"sessionId,omitempty"`    // 未传生成ID时，停止该会话上所有生成
+	} //请求体（停止生成）
+
+	SessionParams struct {
+		Temperature *float32 `json:"temperature"` // 为空时使用人设或模型的默认值
+		TopP        *float32 `json:"topP"`
+		MaxTokens   *int     `json:"maxTokens"`
+	} //会话的生成参数
+
+	UpdateSessionRequest struct {
+		Title     *string        `json:"title,omitempty"`     // 重命名，以下字段不传均表示不修改
+		Pinned    *bool          `json:"pinned,omitempty"`    // 置顶
+		Archived  *bool          `json:"archived,omitempty"`  // 归档
+		ModelType *string        `json:"modelType,omitempty"` // 切换到的模型
+		PersonaID *uint          `json:"personaId,omitempty"` // 人设ID，0表示取消人设，不传表示不修改
+		Params    *SessionParams `json:"params,omitempty"`    // 生成参数，传了则整体替换
+	} //请求体（修改会话）
+	UpdateSessionResponse struct {
+		Session *model.Session `json:"session,omitempty"`
+		controller.Response
+	} //响应体（修改会话）
+
 	ChatHistoryRequest struct {
 		SessionID string `json:"sessionId,omitempty" binding:"required"` // 当前会话ID
 	}
@@ -49,19 +107,25 @@ type (
 )
 
 func GetUserSessionsByUserName(c *gin.Context) {
+	req := new(GetUserSessionsRequest)
 	res := new(GetUserSessionsResponse)
 	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
 
-	userSessions, err := session.GetUserSessionsByUserName(userName)
-	if err != nil {
-		c.JSON(http.StatusOK, res.CodeOf(code.CodeServerBusy))
+	userSessions, nextCursor, code_ := session.ListSessions(userName, req.Archived, req.Deleted, req.Sort, req.Limit, req.Cursor)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
 		return
 	}
 
 	res.Success()
 	res.Sessions = userSessions
+	res.NextCursor = nextCursor
 	c.JSON(http.StatusOK, res)
-} //获取用户所有会话
+} //分页获取用户的会话（置顶的在前）
 
 func CreateSessionAndSendMessage(c *gin.Context) {
 	req := new(CreateSessionAndSendMessageRequest)
@@ -73,7 +137,7 @@ func CreateSessionAndSendMessage(c *gin.Context) {
 		return
 	}
 	//内部会创建会话并发送消息，并会将AI回答、当前会话返回
-	session_id, aiInformation, code_ := session.CreateSessionAndSendMessage(userName, req.UserQuestion, req.ModelType)
+	session_id, aiInformation, sources, code_ := session.CreateSessionAndSendMessage(c.Request.Context(), userName, req.UserQuestion, req.ModelType, req.PersonaID, req.KnowledgeBaseIDs, req.AttachmentIDs)
 
 	if code_ != code.CodeSuccess {
 		c.JSON(http.StatusOK, res.CodeOf(code_))
@@ -83,6 +147,7 @@ func CreateSessionAndSendMessage(c *gin.Context) {
 	res.Success()
 	res.AiInformation = aiInformation
 	res.SessionID = session_id
+	res.Sources = sources
 	c.JSON(http.StatusOK, res)
 }
 
@@ -94,28 +159,22 @@ func CreateStreamSessionAndSendMessage(c *gin.Context) {
 		return //SSE场景不适合统一JSON
 	}
 
-	// 设置SSE头
-	c.Header("Content-Type", "text/event-stream") //声明事件
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive") //防止断流
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("X-Accel-Buffering", "no") // 禁止代理缓存
+	stream, ok := newStream(c)
+	if !ok {
+		return
+	}
+	defer stream.Close()
 
-	// 先创建会话并立即把 sessionId 下发给前端，随后再开始流式输出
-	sessionID, code_ := session.CreateStreamSessionOnly(userName, req.UserQuestion)
+	// 先创建会话，随后开始流式输出；session事件中带有sessionId，前端据此绑定当前会话，侧边栏即可出现新标签
+	sessionID, code_ := session.CreateStreamSessionOnly(userName, req.UserQuestion, req.ModelType, req.PersonaID, req.KnowledgeBaseIDs, req.AttachmentIDs)
 	if code_ != code.CodeSuccess {
-		c.SSEvent("error", gin.H{"message": "Failed to create session"})
+		stream.Error(code_)
 		return
 	}
 
-	// 先把 sessionId 通过 data 事件发送给前端，前端据此绑定当前会话，侧边栏即可出现新标签
-	c.Writer.WriteString(fmt.Sprintf("data: {\"sessionId\": \"%s\"}\n\n", sessionID))
-	c.Writer.Flush() //强制立刻发送给客户端
-
-	// 然后开始把本次回答进行流式发送（包含最后的 [DONE]）
-	code_ = session.StreamMessageToExistingSession(userName, sessionID, req.UserQuestion, req.ModelType, http.ResponseWriter(c.Writer))
+	code_ = session.StreamMessageToExistingSession(c.Request.Context(), userName, sessionID, req.UserQuestion, req.ModelType, req.AttachmentIDs, stream)
 	if code_ != code.CodeSuccess {
-		c.SSEvent("error", gin.H{"message": "Failed to send message"})
+		stream.Error(code_)
 		return
 	}
 } //创建会话+流式返回（SSE）
@@ -129,7 +188,7 @@ func ChatSend(c *gin.Context) {
 		return
 	}
 	// 发送消息，并会将AI回答返回
-	aiInformation, code_ := session.ChatSend(userName, req.SessionID, req.UserQuestion, req.ModelType)
+	aiInformation, sources, code_ := session.ChatSend(c.Request.Context(), userName, req.SessionID, req.UserQuestion, req.ModelType, req.AttachmentIDs)
 
 	if code_ != code.CodeSuccess {
 		c.JSON(http.StatusOK, res.CodeOf(code_))
@@ -138,6 +197,7 @@ func ChatSend(c *gin.Context) {
 
 	res.Success()
 	res.AiInformation = aiInformation
+	res.Sources = sources
 	c.JSON(http.StatusOK, res)
 }
 
@@ -149,16 +209,15 @@ func ChatStreamSend(c *gin.Context) {
 		return
 	}
 
-	// 设置SSE头
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("X-Accel-Buffering", "no") // 禁止代理缓存
+	stream, ok := newStream(c)
+	if !ok {
+		return
+	}
+	defer stream.Close()
 
-	code_ := session.ChatStreamSend(userName, req.SessionID, req.UserQuestion, req.ModelType, http.ResponseWriter(c.Writer))
+	code_ := session.ChatStreamSend(c.Request.Context(), userName, req.SessionID, req.UserQuestion, req.ModelType, req.AttachmentIDs, stream)
 	if code_ != code.CodeSuccess {
-		c.SSEvent("error", gin.H{"message": "Failed to send message"})
+		stream.Error(code_)
 		return
 	}
 
@@ -182,3 +241,208 @@ func ChatHistory(c *gin.Context) {
 	res.History = history
 	c.JSON(http.StatusOK, res)
 } //获取聊天记录
+
+// 创建SSE事件流（设置SSE头），所有流式接口共用；失败时按普通JSON返回
+func newStream(c *gin.Context) (*sse.Writer, bool) {
+	stream, err := sse.NewWriter(c.Writer)
+	if err != nil {
+		log.Println("newStream error:", err)
+		c.JSON(http.StatusOK, new(controller.Response).CodeOf(code.CodeServerBusy))
+		return nil, false
+	}
+	return stream, true
+}
+
+func Regenerate(c *gin.Context) {
+	req := new(RegenerateRequest)
+	res := new(ChatSendResponse)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	aiInformation, sources, code_ := session.Regenerate(c.Request.Context(), userName, req.SessionID, req.ModelType)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.AiInformation = aiInformation
+	res.Sources = sources
+	c.JSON(http.StatusOK, res)
+} //重新生成最后一次回答
+
+func RegenerateStream(c *gin.Context) {
+	req := new(RegenerateRequest)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"error": "Invalid parameters"})
+		return
+	}
+
+	stream, ok := newStream(c)
+	if !ok {
+		return
+	}
+	defer stream.Close()
+	code_ := session.RegenerateStream(c.Request.Context(), userName, req.SessionID, req.ModelType, stream)
+	if code_ != code.CodeSuccess {
+		stream.Error(code_)
+		return
+	}
+} //重新生成最后一次回答（SSE）
+
+func EditMessage(c *gin.Context) {
+	req := new(EditMessageRequest)
+	res := new(ChatSendResponse)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	aiInformation, sources, code_ := session.EditMessage(c.Request.Context(), userName, req.SessionID, req.MessageID, req.UserQuestion, req.ModelType)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.AiInformation = aiInformation
+	res.Sources = sources
+	c.JSON(http.StatusOK, res)
+} //修改之前的问题并重新回答
+
+func EditMessageStream(c *gin.Context) {
+	req := new(EditMessageRequest)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"error": "Invalid parameters"})
+		return
+	}
+
+	stream, ok := newStream(c)
+	if !ok {
+		return
+	}
+	defer stream.Close()
+	code_ := session.EditMessageStream(c.Request.Context(), userName, req.SessionID, req.MessageID, req.UserQuestion, req.ModelType, stream)
+	if code_ != code.CodeSuccess {
+		stream.Error(code_)
+		return
+	}
+} //修改之前的问题并重新回答（SSE）
+
+func ResumeStream(c *gin.Context) {
+	userName := c.GetString("userName") // From JWT middleware
+	var lastEventID int64
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusOK, new(controller.Response).CodeOf(code.CodeInvalidParams))
+			return
+		}
+		lastEventID = id
+	}
+
+	stream, ok := newStream(c)
+	if !ok {
+		return
+	}
+	code_ := session.ResumeStream(c.Request.Context(), userName, c.Param("generationId"), lastEventID, stream)
+	if code_ != code.CodeSuccess {
+		stream.Error(code_)
+		return
+	}
+} //断线后续传一次生成的输出（SSE），从请求头Last-Event-ID之后的事件开始，没有时从头回放
+
+func SwitchBranch(c *gin.Context) {
+	req := new(SwitchBranchRequest)
+	res := new(ChatHistoryResponse)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	history, code_ := session.SwitchBranch(userName, req.SessionID, req.MessageID)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.History = history
+	c.JSON(http.StatusOK, res)
+} //切换分支，返回切换后的聊天记录
+
+func StopGeneration(c *gin.Context) {
+	req := new(StopGenerationRequest)
+	res := new(controller.Response)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindJSON(req); err != nil || (req.GenerationID == "" && req.SessionID == "") {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	code_ := session.StopGeneration(userName, req.GenerationID, req.SessionID)
+	c.JSON(http.StatusOK, res.CodeOf(code_))
+} //停止正在进行的生成，已生成的部分会保存并标记为截断
+
+func UpdateSession(c *gin.Context) {
+	req := new(UpdateSessionRequest)
+	res := new(UpdateSessionResponse)
+	userName := c.GetString("userName")
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	var params *aihelper.GenerationParams
+	if req.Params != nil {
+		params = &aihelper.GenerationParams{
+			Temperature: req.Params.Temperature,
+			TopP:        req.Params.TopP,
+			MaxTokens:   req.Params.MaxTokens,
+		}
+	}
+	sessionID := c.Param("id")
+	//先修改模型配置（会加载会话），再修改展示字段（会把会话从内存中移除）
+	if req.ModelType != nil || req.PersonaID != nil || params != nil {
+		if code_ := session.UpdateSessionConfig(userName, sessionID, req.ModelType, req.PersonaID, params); code_ != code.CodeSuccess {
+			c.JSON(http.StatusOK, res.CodeOf(code_))
+			return
+		}
+	}
+	if code_ := session.UpdateSessionMeta(userName, sessionID, req.Title, req.Pinned, req.Archived); code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	sess, code_ := session.GetSession(userName, sessionID)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+	res.Success()
+	res.Session = sess
+	c.JSON(http.StatusOK, res)
+} //修改会话：重命名、置顶、归档，以及模型、人设和生成参数（立即对之后的生成生效）
+
+func DeleteSession(c *gin.Context) {
+	res := new(controller.Response)
+	userName := c.GetString("userName")
+
+	code_ := session.DeleteSession(userName, c.Param("id"))
+	c.JSON(http.StatusOK, res.CodeOf(code_))
+} //删除会话（软删除，可恢复）
+
+func RestoreSession(c *gin.Context) {
+	res := new(controller.Response)
+	userName := c.GetString("userName")
+
+	code_ := session.RestoreSession(userName, c.Param("id"))
+	c.JSON(http.StatusOK, res.CodeOf(code_))
+} //恢复已删除的会话
@@ -0,0 +1,116 @@
+package transfer
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/transfer"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	ExportRequest struct {
+		Format string `form:"format"` // md / json（默认）/ openai-jsonl
+	} //请求体（导出会话）
+
+	ImportSessionsResponse struct {
+		Sessions []model.SessionInfo `json:"sessions"`
+		controller.Response
+	} //响应体（导入会话）
+)
+
+// 各导出格式的Content-Type
+var contentTypes = map[string]string{
+	transfer.FormatMarkdown: "text/markdown; charset=utf-8",
+	transfer.FormatJSON:     "application/json; charset=utf-8",
+	transfer.FormatOpenAI:   "application/x-ndjson; charset=utf-8",
+}
+
+// 以附件形式下载，文件名可能包含中文
+func attachment(c *gin.Context, fileName string, contentType string, data []byte) {
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(fileName))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+func exportFormat(c *gin.Context) (string, bool) {
+	req := new(ExportRequest)
+	if err := c.ShouldBindQuery(req); err != nil {
+		return "", false
+	}
+	if req.Format == "" {
+		req.Format = transfer.FormatJSON
+	}
+	return req.Format, true
+}
+
+func ExportSession(c *gin.Context) {
+	userName := c.GetString("userName") // From JWT middleware
+	format, ok := exportFormat(c)
+	if !ok {
+		c.JSON(http.StatusOK, new(controller.Response).CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	fileName, data, code_ := transfer.ExportSession(userName, c.Param("id"), format)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, new(controller.Response).CodeOf(code_))
+		return
+	}
+	attachment(c, fileName, contentTypes[format], data)
+} //导出一个会话（Markdown和OpenAI格式只包含当前分支，JSON包含完整的消息树）
+
+func ExportAllSessions(c *gin.Context) {
+	userName := c.GetString("userName")
+	format, ok := exportFormat(c)
+	if !ok {
+		c.JSON(http.StatusOK, new(controller.Response).CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	data, code_ := transfer.ExportAllSessions(userName, format)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, new(controller.Response).CodeOf(code_))
+		return
+	}
+	attachment(c, "GopherAI-"+time.Now().Format("20060102")+".zip", "application/zip", data)
+} //导出用户的所有会话，打包成zip
+
+func ImportSessions(c *gin.Context) {
+	res := new(ImportSessionsResponse)
+	userName := c.GetString("userName")
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+	if file.Size > transfer.MaxImportSize {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeFileTooLarge))
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeServerBusy))
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, transfer.MaxImportSize+1))
+	if err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeServerBusy))
+		return
+	}
+
+	sessions, code_ := transfer.ImportSessions(userName, data)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Sessions = sessions
+	c.JSON(http.StatusOK, res)
+} //导入会话（multipart表单字段file，JSON或JSONL），保留原有的消息时间
@@ -0,0 +1,75 @@
+package usage
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/config"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/usage"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	UsageRequest struct {
+		From string `form:"from"` // 开始日期，格式2006-01-02，默认30天前
+		To   string `form:"to"`   // 结束日期（包含当天），默认今天
+	} //请求体（按时间段查询用量）
+
+	UsageResponse struct {
+		Stats     []model.UsageStat `json:"stats"`
+		TotalCost float64           `json:"totalCost"`
+		Currency  string            `json:"currency,omitempty"`
+		controller.Response
+	} //响应体（用量统计）
+)
+
+// 按时间段查询用量的通用处理
+func handleRange(c *gin.Context, query func(userName string, from string, to string) ([]model.UsageStat, float64, code.Code)) {
+	req := new(UsageRequest)
+	res := new(UsageResponse)
+	userName := c.GetString("userName") // From JWT middleware
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(http.StatusOK, res.CodeOf(code.CodeInvalidParams))
+		return
+	}
+
+	stats, total, code_ := query(userName, req.From, req.To)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Stats = stats
+	res.TotalCost = total
+	res.Currency = config.GetConfig().Currency
+	c.JSON(http.StatusOK, res)
+}
+
+func DailyUsage(c *gin.Context) {
+	handleRange(c, usage.GetDailyUsage)
+} //按天和模型统计用量
+
+func ModelUsage(c *gin.Context) {
+	handleRange(c, usage.GetModelUsage)
+} //按模型统计用量
+
+func SessionUsage(c *gin.Context) {
+	res := new(UsageResponse)
+	userName := c.GetString("userName")
+	sessionID := c.Param("id")
+
+	stats, total, code_ := usage.GetSessionUsage(userName, sessionID)
+	if code_ != code.CodeSuccess {
+		c.JSON(http.StatusOK, res.CodeOf(code_))
+		return
+	}
+
+	res.Success()
+	res.Stats = stats
+	res.TotalCost = total
+	res.Currency = config.GetConfig().Currency
+	c.JSON(http.StatusOK, res)
+} //统计某个会话的用量
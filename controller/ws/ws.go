@@ -0,0 +1,215 @@
+package ws
+
+//WebSocket聊天：一个连接上可以同时进行多个会话的生成
+//客户端发送命令（send / regenerate / stop），服务端推送和SSE相同的事件（session、delta、usage、title、error、done）
+//每个命令带一个客户端生成的requestId，服务端推送的事件带上同一个requestId，客户端据此区分不同的生成
+import (
+	"GopherAI/common/code"
+	"GopherAI/common/sse"
+	"GopherAI/config"
+	"GopherAI/middleware/ratelimit"
+	"GopherAI/service/session"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second   //写一帧的超时时间
+	pongWait       = 60 * time.Second   //超过该时间没有收到pong认为连接已断开
+	pingPeriod     = pongWait * 9 / 10  //服务端发送ping的间隔
+	maxMessageSize = 64 * 1024          //客户端命令的最大长度
+	eventAck       = "ack"              //stop等非流式命令的结果
+	protocolName   = "gopherai.chat.v1" //子协议名称，客户端可以在Sec-WebSocket-Protocol中声明
+)
+
+// 鉴权由JWT完成（浏览器的WebSocket不能设置请求头，token通过URL参数token传递）
+// 浏览器不限制WebSocket跨域，只接受同源和配置中允许的来源，防止其他站点借用户的身份建立连接
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	Subprotocols:    []string{protocolName},
+	CheckOrigin:     checkOrigin,
+}
+
+// 没有Origin请求头的（非浏览器客户端）放行，否则必须与请求的Host一致或在allowedOrigins中
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if slices.Contains(config.GetConfig().MainConfig.AllowedOrigins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+type (
+	Command struct {
+		Type             string   `json:"type"`                       // send / regenerate / stop
+		RequestID        string   `json:"requestId"`                  // 客户端生成，服务端推送的事件带上它
+		SessionID        string   `json:"sessionId,omitempty"`        // send时为空表示创建新会话
+		UserQuestion     string   `json:"question,omitempty"`         // send
+		ModelType        string   `json:"modelType,omitempty"`        // send / regenerate
+		PersonaID        uint     `json:"personaId,omitempty"`        // 创建新会话时的人设（可选）
+		KnowledgeBaseIDs []uint   `json:"knowledgeBaseIds,omitempty"` // 创建新会话时挂载的知识库（可选）
+		AttachmentIDs    []string `json:"attachmentIds,omitempty"`    // send时附带的图片
+		GenerationID     string   `json:"generationId,omitempty"`     // stop：要停止的生成，为空时停止sessionId上所有生成
+	} //客户端命令
+
+	Frame struct {
+		RequestID string          `json:"requestId,omitempty"`
+		Event     string          `json:"event"`
+		Payload   json.RawMessage `json:"payload"` // 和SSE事件的data相同：{v, id, messageId, data}
+	} //服务端推送的一帧
+
+	AckData struct {
+		Code    code.Code `json:"code"`
+		Message string    `json:"message"`
+	} //stop等命令的结果
+)
+
+// 一个WebSocket连接
+type conn struct {
+	ws       *websocket.Conn
+	userName string
+	ctx      context.Context //连接断开时取消
+	mu       sync.Mutex      //gorilla/websocket不支持并发写
+}
+
+func (c *conn) writeFrame(f Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.ws.WriteJSON(f)
+}
+
+// 发送一个不属于流式生成的事件（命令结果、命令错误）
+func (c *conn) reply(requestID string, event string, data interface{}) {
+	payload, _ := json.Marshal(sse.Envelope{Version: sse.Version, Data: data})
+	if err := c.writeFrame(Frame{RequestID: requestID, Event: event, Payload: payload}); err != nil {
+		log.Println("[WS] write error:", err)
+	}
+}
+
+func (c *conn) replyError(requestID string, code_ code.Code) {
+	c.reply(requestID, sse.EventError, sse.ErrorData{Code: code_, Message: code_.Msg()})
+}
+
+func Chat(c *gin.Context) {
+	userName := c.GetString("userName") // From JWT middleware
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Println("[WS] upgrade error:", err)
+		return //Upgrade已经返回了错误响应
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := &conn{ws: ws, userName: userName, ctx: ctx}
+	defer ws.Close()
+
+	go conn.keepAlive()
+	conn.readLoop()
+} //WebSocket聊天（/AI/ws），在一个连接上发送、停止、重新生成，并接收服务端推送的事件
+
+// 定时发送ping，连接断开后退出
+func (c *conn) keepAlive() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// 读取并分发客户端命令，连接断开时返回
+// 连接断开时：开启续传的生成继续进行，可以通过SSE续传接口继续接收；未开启续传时生成随连接一起停止（和SSE接口一致）
+func (c *conn) readLoop() {
+	c.ws.SetReadLimit(maxMessageSize)
+	c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		cmd := new(Command)
+		if err := c.ws.ReadJSON(cmd); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				c.replyError("", code.CodeInvalidParams)
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("[WS] read error:", err)
+			}
+			return
+		}
+		c.ws.SetReadDeadline(time.Now().Add(pongWait))
+
+		switch cmd.Type {
+		case "send", "regenerate":
+			go c.runStream(cmd)
+		case "stop":
+			if cmd.GenerationID == "" && cmd.SessionID == "" {
+				c.replyError(cmd.RequestID, code.CodeInvalidParams)
+				continue
+			}
+			code_ := session.StopGeneration(c.userName, cmd.GenerationID, cmd.SessionID)
+			c.reply(cmd.RequestID, eventAck, AckData{Code: code_, Message: code_.Msg()})
+		default:
+			c.replyError(cmd.RequestID, code.CodeInvalidParams)
+		}
+	}
+}
+
+// 执行一次流式生成，事件通过和SSE相同的Writer推送
+func (c *conn) runStream(cmd *Command) {
+	if (cmd.Type == "send" && cmd.UserQuestion == "") || (cmd.Type == "regenerate" && cmd.SessionID == "") {
+		c.replyError(cmd.RequestID, code.CodeInvalidParams)
+		return
+	}
+	release, code_ := ratelimit.AcquireStream(c.userName)
+	if code_ != code.CodeSuccess {
+		c.replyError(cmd.RequestID, code_)
+		return
+	}
+	defer release()
+
+	stream := sse.NewFuncWriter(func(id int64, event string, payload []byte) error {
+		return c.writeFrame(Frame{RequestID: cmd.RequestID, Event: event, Payload: payload})
+	})
+	defer stream.Close()
+
+	switch {
+	case cmd.Type == "regenerate":
+		code_ = session.RegenerateStream(c.ctx, c.userName, cmd.SessionID, cmd.ModelType, stream)
+	case cmd.SessionID == "":
+		_, code_ = session.CreateStreamSessionAndSendMessage(c.ctx, c.userName, cmd.UserQuestion, cmd.ModelType, cmd.PersonaID, cmd.KnowledgeBaseIDs, cmd.AttachmentIDs, stream)
+	default:
+		code_ = session.ChatStreamSend(c.ctx, c.userName, cmd.SessionID, cmd.UserQuestion, cmd.ModelType, cmd.AttachmentIDs, stream)
+	}
+	if code_ != code.CodeSuccess {
+		stream.Error(code_)
+	}
+}
@@ -0,0 +1,25 @@
+package attachment
+
+import (
+	"GopherAI/common/mysql"
+	"GopherAI/model"
+)
+
+func CreateAttachment(att *model.Attachment) (*model.Attachment, error) {
+	err := mysql.DB.Create(att).Error
+	return att, err
+}
+
+// 根据ID查找图片（只能查到自己上传的）
+func GetAttachmentByID(userName string, id string) (*model.Attachment, error) {
+	var att model.Attachment
+	err := mysql.DB.Where("id = ? AND user_name = ?", id, userName).First(&att).Error
+	return &att, err
+}
+
+// 批量查找用户上传的图片
+func GetAttachmentsByIDs(userName string, ids []string) ([]model.Attachment, error) {
+	var atts []model.Attachment
+	err := mysql.DB.Where("id IN ? AND user_name = ?", ids, userName).Find(&atts).Error
+	return atts, err
+}
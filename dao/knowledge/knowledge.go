@@ -0,0 +1,166 @@
+package knowledge
+
+import (
+	"GopherAI/common/mysql"
+	"GopherAI/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func CreateKnowledgeBase(kb *model.KnowledgeBase) (*model.KnowledgeBase, error) {
+	err := mysql.DB.Create(kb).Error
+	return kb, err
+}
+
+// 根据ID查找知识库（只能查到自己创建的）
+func GetKnowledgeBaseByID(userName string, id uint) (*model.KnowledgeBase, error) {
+	var kb model.KnowledgeBase
+	err := mysql.DB.Where("id = ? AND user_name = ?", id, userName).First(&kb).Error
+	return &kb, err
+}
+
+// 查找用户创建的所有知识库
+func GetKnowledgeBasesByUserName(userName string) ([]model.KnowledgeBase, error) {
+	var kbs []model.KnowledgeBase
+	err := mysql.DB.Where("user_name = ?", userName).Order("created_at asc").Find(&kbs).Error
+	return kbs, err
+}
+
+// 统计ids中有多少个属于该用户
+func CountKnowledgeBases(userName string, ids []uint) (int64, error) {
+	var n int64
+	err := mysql.DB.Model(&model.KnowledgeBase{}).Where("id IN ? AND user_name = ?", ids, userName).Count(&n).Error
+	return n, err
+}
+
+// 删除知识库及其文档、切片和会话挂载关系
+func DeleteKnowledgeBase(userName string, id uint) (int64, error) {
+	var rows int64
+	err := mysql.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_name = ?", id, userName).Delete(&model.KnowledgeBase{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		rows = result.RowsAffected
+		if err := tx.Where("knowledge_base_id = ?", id).Delete(&model.Chunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("knowledge_base_id = ?", id).Delete(&model.Document{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("knowledge_base_id = ?", id).Delete(&model.SessionKnowledgeBase{}).Error
+	})
+	return rows, err
+}
+
+func CreateDocument(doc *model.Document) (*model.Document, error) {
+	err := mysql.DB.Create(doc).Error
+	return doc, err
+}
+
+// 查找知识库下的所有文档
+func GetDocuments(knowledgeBaseID uint) ([]model.Document, error) {
+	var docs []model.Document
+	err := mysql.DB.Where("knowledge_base_id = ?", knowledgeBaseID).Order("created_at asc").Find(&docs).Error
+	return docs, err
+}
+
+// 更新文档处理状态
+func UpdateDocumentStatus(id uint, status string, chunkCount int, errMsg string) error {
+	return mysql.DB.Model(&model.Document{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"chunk_count": chunkCount,
+		"error":       errMsg,
+	}).Error
+}
+
+// 删除文档及其切片
+func DeleteDocument(knowledgeBaseID uint, id uint) (int64, error) {
+	var rows int64
+	err := mysql.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND knowledge_base_id = ?", id, knowledgeBaseID).Delete(&model.Document{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		rows = result.RowsAffected
+		return tx.Where("document_id = ?", id).Delete(&model.Chunk{}).Error
+	})
+	return rows, err
+}
+
+// 文档还存在时批量保存它的切片，返回false表示文档（或所在知识库）已被删除
+// 锁住文档行后再写入，与删除文档、删除知识库的事务互斥，不会留下无主的切片
+func CreateDocumentChunks(documentID uint, chunks []model.Chunk) (bool, error) {
+	exists := false
+	err := mysql.DB.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&model.Document{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", documentID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		exists = true
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(chunks, 100).Error
+	})
+	return exists, err
+}
+
+// 文档是否还存在
+func DocumentExists(id uint) (bool, error) {
+	var n int64
+	err := mysql.DB.Model(&model.Document{}).Where("id = ?", id).Count(&n).Error
+	return n > 0, err
+}
+
+// 分批遍历所有切片（启动时重建向量索引）
+func EachChunks(batch int, fn func(chunks []model.Chunk) error) error {
+	var chunks []model.Chunk
+	return mysql.DB.Order("id asc").FindInBatches(&chunks, batch, func(tx *gorm.DB, _ int) error {
+		return fn(chunks)
+	}).Error
+}
+
+// 查找文档的文件名（检索结果展示引用来源）
+func GetDocumentNames(ids []uint) (map[uint]string, error) {
+	var docs []model.Document
+	names := make(map[uint]string)
+	if len(ids) == 0 {
+		return names, nil
+	}
+	if err := mysql.DB.Select("id", "file_name").Where("id IN ?", ids).Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		names[doc.ID] = doc.FileName
+	}
+	return names, nil
+}
+
+// 设置会话挂载的知识库（整体替换）
+func SetSessionKnowledgeBases(sessionID string, ids []uint) error {
+	return mysql.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Delete(&model.SessionKnowledgeBase{}).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		rows := make([]model.SessionKnowledgeBase, 0, len(ids))
+		for _, id := range ids {
+			rows = append(rows, model.SessionKnowledgeBase{SessionID: sessionID, KnowledgeBaseID: id})
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// 查找会话挂载的知识库ID
+func GetSessionKnowledgeBaseIDs(sessionID string) ([]uint, error) {
+	var ids []uint
+	err := mysql.DB.Model(&model.SessionKnowledgeBase{}).Where("session_id = ?", sessionID).Pluck("knowledge_base_id", &ids).Error
+	return ids, err
+}
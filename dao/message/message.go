@@ -3,6 +3,9 @@ package message
 import (
 	"GopherAI/common/mysql"
 	"GopherAI/model"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 func CreateMessage(message *model.Message) (*model.Message, error) {
@@ -12,7 +15,7 @@ func CreateMessage(message *model.Message) (*model.Message, error) {
 
 func GetMessagesBySessionID(sessionID string) ([]model.Message, error) {
 	var msgs []model.Message
-	err := mysql.DB.Where("session_id = ?", sessionID).Order("created_at asc").Find(&msgs).Error
+	err := mysql.DB.Where("session_id = ?", sessionID).Order("created_at asc, id asc").Find(&msgs).Error
 	return msgs, err
 } //查询某一个ID下的所有消息
 
@@ -21,13 +24,78 @@ func GetMessagesBySessionIDs(sessionIDs []string) ([]model.Message, error) {
 	if len(sessionIDs) == 0 {
 		return msgs, nil
 	}
-	err := mysql.DB.Where("session_id IN ?", sessionIDs).Order("created_at asc").Find(&msgs).Error
+	err := mysql.DB.Where("session_id IN ?", sessionIDs).Order("created_at asc, id asc").Find(&msgs).Error
 	return msgs, err
 } //查询多个ID下的所有消息
 
-func GetAllMessages() ([]model.Message, error) {
-	var msgs []model.Message
-	err := mysql.DB.Order("created_at asc").Find(&msgs).Error
-	return msgs, err
-} //查找所有消息
-//asc表示升序
+// 给升级前没有消息ID的历史消息补上ID
+func BackfillMessageIDs() error {
+	return mysql.DB.Model(&model.Message{}).
+		Where("message_id = '' OR message_id IS NULL").
+		Update("message_id", gorm.Expr("UUID()")).Error
+}
+
+// 给升级前的线性会话补上父消息：没有任何消息带父ID的会话，按时间顺序把消息串成一条链
+func BackfillParentIDs() error {
+	var sessionIDs []string
+	err := mysql.DB.Model(&model.Message{}).
+		Group("session_id").
+		Having("MAX(parent_id) = '' OR MAX(parent_id) IS NULL").
+		Having("COUNT(*) > 1").
+		Pluck("session_id", &sessionIDs).Error
+	if err != nil || len(sessionIDs) == 0 {
+		return err
+	}
+
+	return mysql.DB.Transaction(func(tx *gorm.DB) error {
+		for _, sessionID := range sessionIDs {
+			var msgs []model.Message
+			if err := tx.Where("session_id = ?", sessionID).Order("created_at asc, id asc").Find(&msgs).Error; err != nil {
+				return err
+			}
+			for i := 1; i < len(msgs); i++ {
+				if err := tx.Model(&model.Message{}).Where("id = ?", msgs[i].ID).Update("parent_id", msgs[i-1].MessageID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// 用量统计只统计模型生成的消息
+const usageSelect = "model_id, COUNT(*) AS requests, SUM(prompt_tokens) AS prompt_tokens, " +
+	"SUM(completion_tokens) AS completion_tokens, SUM(total_tokens) AS total_tokens"
+
+// 按天和模型聚合用户在[from, to)时间段内的用量
+func GetUsageByDay(userName string, from time.Time, to time.Time) ([]model.UsageStat, error) {
+	var stats []model.UsageStat
+	err := mysql.DB.Model(&model.Message{}).
+		Select("DATE_FORMAT(created_at, '%Y-%m-%d') AS date, "+usageSelect).
+		Where("user_name = ? AND is_user = ? AND model_id <> '' AND created_at >= ? AND created_at < ?", userName, false, from, to).
+		Group("date, model_id").Order("date asc, model_id asc").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// 按模型聚合用户在[from, to)时间段内的用量
+func GetUsageByModel(userName string, from time.Time, to time.Time) ([]model.UsageStat, error) {
+	var stats []model.UsageStat
+	err := mysql.DB.Model(&model.Message{}).
+		Select(usageSelect).
+		Where("user_name = ? AND is_user = ? AND model_id <> '' AND created_at >= ? AND created_at < ?", userName, false, from, to).
+		Group("model_id").Order("model_id asc").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// 按模型聚合某个会话的用量
+func GetUsageBySession(userName string, sessionID string) ([]model.UsageStat, error) {
+	var stats []model.UsageStat
+	err := mysql.DB.Model(&model.Message{}).
+		Select(usageSelect).
+		Where("user_name = ? AND session_id = ? AND is_user = ? AND model_id <> ''", userName, sessionID, false).
+		Group("model_id").Order("model_id asc").
+		Scan(&stats).Error
+	return stats, err
+}
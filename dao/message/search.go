@@ -0,0 +1,81 @@
+package message
+
+import (
+	"GopherAI/common/mysql"
+	"GopherAI/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SearchOptions 聊天记录搜索的过滤条件，零值表示不限制
+type SearchOptions struct {
+	From      time.Time //[From, To)时间段
+	To        time.Time
+	ModelID   string //只搜索该模型的回答
+	SessionID string //只搜索该会话
+	Limit     int
+	Offset    int
+}
+
+// MessageHit 搜索命中的消息，附带所在会话的标题
+type MessageHit struct {
+	model.Message
+	SessionTitle string
+	Score        float64
+}
+
+// 搜索范围：用户自己未删除会话中的问题和回答（不含工具调用过程）
+func searchScope(userName string, opts SearchOptions) *gorm.DB {
+	db := mysql.DB.Table("messages").
+		Joins("JOIN sessions ON sessions.id = messages.session_id AND sessions.deleted_at IS NULL").
+		Where("messages.user_name = ?", userName).
+		Where("COALESCE(messages.tool_call_id, '') = '' AND COALESCE(messages.tool_calls, '') = ''")
+	if !opts.From.IsZero() {
+		db = db.Where("messages.created_at >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		db = db.Where("messages.created_at < ?", opts.To)
+	}
+	if opts.ModelID != "" {
+		db = db.Where("messages.model_id = ?", opts.ModelID)
+	}
+	if opts.SessionID != "" {
+		db = db.Where("messages.session_id = ?", opts.SessionID)
+	}
+	return db
+}
+
+// 全文检索用户的消息，query为BOOLEAN MODE的检索式，按相关度排序
+func SearchMessages(userName string, query string, opts SearchOptions) ([]MessageHit, error) {
+	var hits []MessageHit
+	err := searchScope(userName, opts).
+		Select("messages.*, sessions.title AS session_title, MATCH(messages.content) AGAINST(? IN BOOLEAN MODE) AS score", query).
+		Where("MATCH(messages.content) AGAINST(? IN BOOLEAN MODE)", query).
+		Order("score desc").Order("messages.id desc").
+		Limit(opts.Limit).Offset(opts.Offset).
+		Scan(&hits).Error
+	return hits, err
+}
+
+// 按消息ID查找用户的消息（语义检索命中后回表，同时应用过滤条件）
+func GetMessageHits(userName string, messageIDs []string, opts SearchOptions) ([]MessageHit, error) {
+	var hits []MessageHit
+	if len(messageIDs) == 0 {
+		return hits, nil
+	}
+	err := searchScope(userName, opts).
+		Select("messages.*, sessions.title AS session_title").
+		Where("messages.message_id IN ?", messageIDs).
+		Scan(&hits).Error
+	return hits, err
+}
+
+// 按自增ID顺序取afterID之后可被搜索的消息（后台向量化用）
+func GetSearchableMessagesAfter(afterID uint, limit int) ([]model.Message, error) {
+	var msgs []model.Message
+	err := mysql.DB.Where("id > ? AND content <> ''", afterID).
+		Where("COALESCE(tool_call_id, '') = '' AND COALESCE(tool_calls, '') = ''").
+		Order("id asc").Limit(limit).Find(&msgs).Error
+	return msgs, err
+}
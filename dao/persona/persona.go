@@ -0,0 +1,36 @@
+package persona
+
+import (
+	"GopherAI/common/mysql"
+	"GopherAI/model"
+)
+
+func CreatePersona(persona *model.Persona) (*model.Persona, error) {
+	err := mysql.DB.Create(persona).Error
+	return persona, err
+}
+
+// 根据ID查找人设（只能查到自己创建的）
+func GetPersonaByID(userName string, id uint) (*model.Persona, error) {
+	var persona model.Persona
+	err := mysql.DB.Where("id = ? AND user_name = ?", id, userName).First(&persona).Error
+	return &persona, err
+}
+
+// 查找用户创建的所有人设
+func GetPersonasByUserName(userName string) ([]model.Persona, error) {
+	var personas []model.Persona
+	err := mysql.DB.Where("user_name = ?", userName).Order("created_at asc").Find(&personas).Error
+	return personas, err
+}
+
+// 更新人设（Select指定列，保证温度可以被清空为NULL）
+func UpdatePersona(persona *model.Persona) error {
+	return mysql.DB.Model(persona).Select("name", "system_prompt", "model_type", "temperature").Updates(persona).Error
+}
+
+// 删除人设（软删除）
+func DeletePersona(userName string, id uint) (int64, error) {
+	result := mysql.DB.Where("id = ? AND user_name = ?", id, userName).Delete(&model.Persona{})
+	return result.RowsAffected, result.Error
+}
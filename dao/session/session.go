@@ -3,6 +3,9 @@ package session
 import (
 	"GopherAI/common/mysql"
 	"GopherAI/model"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 func CreateSession(session *model.Session) (*model.Session, error) {
@@ -17,9 +20,112 @@ func GetSessionByID(sessionID string) (*model.Session, error) {
 	return &session, err
 }
 
-// 根据用户名查找会话
-func GetSessionByUserName(UserName int64) ([]model.Session, error) {
+// 根据ID查找某个用户的会话
+func GetUserSessionByID(userName string, sessionID string) (*model.Session, error) {
+	var session model.Session
+	err := mysql.DB.Where("id = ? AND user_name = ?", sessionID, userName).First(&session).Error
+	return &session, err
+}
+
+// 会话列表的翻页位置：上一页最后一条会话的排序字段
+type Cursor struct {
+	Pinned bool      `json:"p"`
+	Time   time.Time `json:"t"`
+	ID     string    `json:"id"`
+}
+
+// 会话列表的查询条件
+type ListOptions struct {
+	Archived bool    //true只列出归档的会话，false只列出未归档的会话
+	Deleted  bool    //只列出已删除（可恢复）的会话，此时忽略Archived
+	SortBy   string  //排序字段：updated_at / created_at，均为倒序，置顶的会话总在最前
+	Limit    int     //每页条数
+	After    *Cursor //从该位置之后开始，nil表示第一页
+}
+
+// 按条件分页查询用户的会话
+func ListSessions(userName string, opts ListOptions) ([]model.Session, error) {
+	var sessions []model.Session
+	db := mysql.DB.Where("user_name = ?", userName)
+	if opts.Deleted {
+		db = mysql.DB.Unscoped().Where("user_name = ? AND deleted_at IS NOT NULL", userName)
+	} else {
+		db = db.Where("archived = ?", opts.Archived)
+	}
+	col := opts.SortBy
+	if c := opts.After; c != nil {
+		db = db.Where("(pinned < ? OR (pinned = ? AND ("+col+" < ? OR ("+col+" = ? AND id < ?))))",
+			c.Pinned, c.Pinned, c.Time, c.Time, c.ID)
+	}
+	err := db.Order("pinned desc").Order(col + " desc").Order("id desc").Limit(opts.Limit).Find(&sessions).Error
+	return sessions, err
+}
+
+// 查找用户所有未删除的会话（导出用），按创建时间排序
+func GetAllSessionsByUserName(userName string) ([]model.Session, error) {
 	var sessions []model.Session
-	err := mysql.DB.Where("user_name = ?", UserName).Find(&sessions).Error
+	err := mysql.DB.Where("user_name = ?", userName).Order("created_at asc").Find(&sessions).Error
 	return sessions, err
 }
+
+// 在一个事务中创建会话及其消息（导入用），消息保留原有的时间
+func CreateSessionWithMessages(session *model.Session, msgs []model.Message) error {
+	return mysql.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(msgs, 200).Error
+	})
+}
+
+// 修改会话的标题、置顶、归档等展示字段（不更新updated_at，避免打乱按活跃时间的排序）
+func UpdateSessionColumns(userName string, sessionID string, columns map[string]interface{}) error {
+	return mysql.DB.Model(&model.Session{}).Where("id = ? AND user_name = ?", sessionID, userName).UpdateColumns(columns).Error
+}
+
+// 软删除会话，返回影响的行数
+func DeleteSession(userName string, sessionID string) (int64, error) {
+	result := mysql.DB.Where("id = ? AND user_name = ?", sessionID, userName).Delete(&model.Session{})
+	return result.RowsAffected, result.Error
+}
+
+// 恢复软删除的会话，返回影响的行数
+func RestoreSession(userName string, sessionID string) (int64, error) {
+	result := mysql.DB.Unscoped().Model(&model.Session{}).
+		Where("id = ? AND user_name = ? AND deleted_at IS NOT NULL", sessionID, userName).
+		Update("deleted_at", nil)
+	return result.RowsAffected, result.Error
+}
+
+// 写入自动生成的标题，只在标题还没有生成过（用户也没有手动修改过）时生效，返回是否写入
+func UpdateGeneratedTitle(sessionID string, title string) (bool, error) {
+	result := mysql.DB.Model(&model.Session{}).Where("id = ? AND title_generated = ?", sessionID, false).
+		UpdateColumns(map[string]interface{}{"title": title, "title_generated": true})
+	return result.RowsAffected > 0, result.Error
+}
+
+// 更新会话的模型配置（模型、人设、生成参数），updates中的nil会把对应字段清空
+func UpdateSessionConfig(sessionID string, updates map[string]interface{}) error {
+	return mysql.DB.Model(&model.Session{}).Where("id = ?", sessionID).Updates(updates).Error
+}
+
+// 更新会话使用的模型
+func UpdateSessionModelType(sessionID string, modelType string) error {
+	return mysql.DB.Model(&model.Session{}).Where("id = ?", sessionID).Update("model_type", modelType).Error
+}
+
+// 更新会话的滚动摘要
+func UpdateSessionSummary(sessionID string, summary string, summarizedUntil string) error {
+	return mysql.DB.Model(&model.Session{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+		"summary":          summary,
+		"summarized_until": summarizedUntil,
+	}).Error
+}
+
+// 更新会话当前所在的分支
+func UpdateActiveLeaf(sessionID string, leafID string) error {
+	return mysql.DB.Model(&model.Session{}).Where("id = ?", sessionID).Update("active_leaf_id", leafID).Error
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
-	"GopherAI/common/aihelper"
 	"GopherAI/common/mysql"
 	"GopherAI/common/rabbitmq"
+	"GopherAI/common/rag"
 	"GopherAI/common/redis"
 	"GopherAI/config"
 	"GopherAI/dao/message"
 	"GopherAI/router"
+	"GopherAI/service/search"
 	"fmt"
 	"log"
 	"os"
@@ -25,36 +26,6 @@ func StartServer(addr string, port int) error {
 	return r.Run(fmt.Sprintf("%s:%d", addr, port))
 }
 
-// 从数据库加载消息并初始化 AIHelperManager
-func readDataFromDB() error {
-	manager := aihelper.GetGlobalManager()
-	// 从数据库读取所有消息
-	msgs, err := message.GetAllMessages()
-	if err != nil {
-		return err
-	}
-	// 遍历数据库消息
-	for i := range msgs {
-		m := &msgs[i]
-		//默认openai模型
-		modelType := "1"
-		config := make(map[string]interface{})
-
-		// 创建对应的 AIHelper
-		helper, err := manager.GetOrCreateAIHelper(m.UserName, m.SessionID, modelType, config)
-		if err != nil {
-			log.Printf("[readDataFromDB] failed to create helper for user=%s session=%s: %v", m.UserName, m.SessionID, err)
-			continue
-		}
-		log.Println("readDataFromDB init:  ", helper.SessionID)
-		// 添加消息到内存中(不开启存储功能)
-		helper.AddMessage(m.Content, m.UserName, m.IsUser, false)
-	}
-
-	log.Println("AIHelperManager init success ")
-	return nil
-}
-
 func main() {
 	conf := config.GetConfig()
 	host := conf.MainConfig.Host
@@ -64,9 +35,15 @@ func main() {
 		log.Println("InitMysql error , " + err.Error())
 		return
 	}
-	//初始化AIHelperManager
-	readDataFromDB()
-
+	//给升级前的历史消息补上消息ID和父消息（一次性迁移，完成后不再扫描消息表）
+	if err := mysql.RunOnce("backfill_message_tree", func() error {
+		if err := message.BackfillMessageIDs(); err != nil {
+			return err
+		}
+		return message.BackfillParentIDs()
+	}); err != nil {
+		log.Println("backfill_message_tree error , " + err.Error())
+	}
 	//初始化redis
 	if err := redis.Init(); err!=nil{
 		log.Fatalf("redis init failed: %v",err)
@@ -76,6 +53,12 @@ func main() {
 		log.Fatalf("rabbitmq init failed: %v",err)
 	}
 	log.Println("rabbitmq init success  ")
+	//加载知识库向量索引（redis后端依赖redis初始化）
+	if err := rag.LoadIndex(); err != nil {
+		log.Println("LoadIndex error , " + err.Error())
+	}
+	//开启语义搜索时在后台向量化聊天记录
+	search.StartIndexer()
 
 	// err := StartServer(host, port) // 启动 HTTP 服务
 	// if err != nil {
@@ -109,7 +92,7 @@ func main() {
 	defer cancel()//这5秒钟用于处理还没有处理完成的旧请求
 
 	if err := srv.Shutdown(ctx); err != nil{
-		log.Fatalf("HTTP Server 强制关闭异常:",err)
+		log.Fatalf("HTTP Server 强制关闭异常: %v", err)
 	}
 
 	//安全销毁消息队列
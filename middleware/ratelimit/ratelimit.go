@@ -0,0 +1,171 @@
+package ratelimit
+
+//按用户限流的中间件
+//1.每分钟请求数：Redis有序集合实现的滑动窗口
+//2.每日token额度：回复完成后累加当天消耗，超出后当天不再放行
+//3.并发流式输出数：占用槽位，请求结束后释放
+//计数都在Redis中，多个后端实例共享同一份限额；Redis异常时放行，避免限流组件拖垮主流程
+import (
+	"GopherAI/common/code"
+	"GopherAI/common/redis"
+	"GopherAI/config"
+	"GopherAI/controller"
+	"GopherAI/model"
+	"GopherAI/service/ratelimit"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 流式输出槽位的最长占用时间，超过后即使没有释放也会被回收
+const streamSlotTTL = 10 * time.Minute
+
+type LimitResponse struct {
+	RetryAfter int `json:"retryAfter,omitempty"` //建议多少秒后重试
+	controller.Response
+}
+
+// 拒绝请求：返回429，并通过Retry-After头告知客户端等待时间
+func reject(c *gin.Context, code_ code.Code, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	res := &LimitResponse{RetryAfter: seconds}
+	res.CodeOf(code_)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, res)
+}
+
+// 距离第二天零点的时间（每日额度在零点重置）
+func untilTomorrow() time.Duration {
+	now := time.Now()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	return tomorrow.Sub(now)
+}
+
+// 检查每分钟请求数和每日token额度，返回用户的限额；不通过时返回对应的状态码和建议等待的时间
+func evaluate(userName string) (model.UserLimit, code.Code, time.Duration) {
+	l, err := ratelimit.GetEffectiveLimit(userName)
+	if err != nil {
+		log.Println("ratelimit: get limit error:", err)
+	}
+
+	if l.DailyTokens > 0 {
+		used, err := redis.GetDailyTokens(userName)
+		if err != nil {
+			log.Println("ratelimit: get daily tokens error:", err)
+		} else if used >= l.DailyTokens {
+			return l, code.CodeQuotaExceeded, untilTomorrow()
+		}
+	}
+
+	if l.RequestsPerMinute > 0 {
+		ok, wait, err := redis.AllowRequest(userName, l.RequestsPerMinute, time.Minute)
+		if err != nil {
+			log.Println("ratelimit: sliding window error:", err)
+		} else if !ok {
+			return l, code.CodeTooManyRequests, wait
+		}
+	}
+	return l, code.CodeSuccess, 0
+}
+
+// 检查每分钟请求数和每日token额度，通过时返回用户的限额，不通过时已经写好了响应
+func check(c *gin.Context, userName string) (model.UserLimit, bool) {
+	l, code_, wait := evaluate(userName)
+	if code_ != code.CodeSuccess {
+		reject(c, code_, wait)
+		return l, false
+	}
+	return l, true
+}
+
+// 占用一个流式输出槽位，返回释放函数；槽位已满时ok为false，Redis异常时放行
+func acquireSlot(userName string, l model.UserLimit) (func(), bool) {
+	if l.MaxConcurrentStreams <= 0 {
+		return func() {}, true
+	}
+	slot, ok, err := redis.AcquireStreamSlot(userName, l.MaxConcurrentStreams, streamSlotTTL)
+	if err != nil {
+		log.Println("ratelimit: acquire stream slot error:", err)
+		return func() {}, true
+	}
+	if !ok {
+		return nil, false
+	}
+	return func() {
+		if err := redis.ReleaseStreamSlot(userName, slot); err != nil {
+			log.Println("ratelimit: release stream slot error:", err)
+		}
+	}, true
+}
+
+// AcquireStream 不经过HTTP中间件的流式输出（如WebSocket上的一条命令）使用的限流，和StreamLimit的规则相同
+// 通过时返回结束后需要调用的释放函数
+func AcquireStream(userName string) (func(), code.Code) {
+	if !config.GetConfig().RateLimitConfig.Enabled {
+		return func() {}, code.CodeSuccess
+	}
+	l, code_, _ := evaluate(userName)
+	if code_ != code.CodeSuccess {
+		return nil, code_
+	}
+	release, ok := acquireSlot(userName, l)
+	if !ok {
+		return nil, code.CodeTooManyStreams
+	}
+	return release, code.CodeSuccess
+}
+
+// Limit 限制普通请求的频率和每日额度
+func Limit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.GetConfig().RateLimitConfig.Enabled {
+			c.Next()
+			return
+		}
+		if _, ok := check(c, c.GetString("userName")); !ok {
+			return
+		}
+		c.Next()
+	}
+}
+
+// StreamLimit 在Limit的基础上，额外限制同时进行的流式输出数
+func StreamLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.GetConfig().RateLimitConfig.Enabled {
+			c.Next()
+			return
+		}
+		userName := c.GetString("userName")
+		l, ok := check(c, userName)
+		if !ok {
+			return
+		}
+
+		release, ok := acquireSlot(userName, l)
+		if !ok {
+			reject(c, code.CodeTooManyStreams, 5*time.Second)
+			return
+		}
+		defer release()
+		c.Next() //流式输出在Next中完成，结束后释放槽位
+	}
+}
+
+// AdminOnly 只允许配置文件中的管理员访问
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.GetConfig().IsAdmin(c.GetString("userName")) {
+			c.AbortWithStatusJSON(http.StatusForbidden, new(controller.Response).CodeOf(code.CodeForbidden))
+			return
+		}
+		c.Next()
+	}
+}
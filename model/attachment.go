@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// Attachment 聊天中上传的图片，文件保存在磁盘上，这里记录元数据
+type Attachment struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	UserName  string    `gorm:"index;type:varchar(20)" json:"-"`
+	FileName  string    `gorm:"type:varchar(255)" json:"fileName"`
+	MIMEType  string    `gorm:"type:varchar(50)" json:"mimeType"`
+	Size      int64     `json:"size"`
+	Label     string    `gorm:"type:varchar(100)" json:"label,omitempty"` //本地图像分类结果，给看不了图片的模型作提示
+	CreatedAt time.Time `json:"-"`
+}
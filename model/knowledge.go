@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// KnowledgeBase 知识库，由用户上传的文档组成
+type KnowledgeBase struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserName    string         `gorm:"index;not null;type:varchar(20)" json:"username"`
+	Name        string         `gorm:"type:varchar(50);not null" json:"name"`
+	Description string         `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// 文档处理状态
+const (
+	DocumentProcessing = "processing" //正在解析、切片、向量化
+	DocumentReady      = "ready"      //可以检索
+	DocumentFailed     = "failed"     //处理失败，原因见Error
+)
+
+// Document 知识库中的一篇文档
+type Document struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	KnowledgeBaseID uint      `gorm:"index;not null" json:"knowledge_base_id"`
+	UserName        string    `gorm:"type:varchar(20)" json:"username"`
+	FileName        string    `gorm:"type:varchar(255)" json:"file_name"`
+	Size            int64     `json:"size"`
+	ChunkCount      int       `gorm:"not null;default:0" json:"chunk_count"`
+	Status          string    `gorm:"type:varchar(20)" json:"status"`
+	Error           string    `gorm:"type:varchar(255)" json:"error,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Chunk 文档切片及其向量
+type Chunk struct {
+	ID              uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	KnowledgeBaseID uint   `gorm:"index;not null" json:"knowledge_base_id"`
+	DocumentID      uint   `gorm:"index;not null" json:"document_id"`
+	Seq             int    `json:"seq"` //在文档中的序号
+	Content         string `gorm:"type:text" json:"content"`
+	Embedding       string `gorm:"type:mediumtext" json:"-"` //向量（JSON数组）
+}
+
+// SessionKnowledgeBase 会话挂载的知识库
+type SessionKnowledgeBase struct {
+	SessionID       string `gorm:"primaryKey;type:varchar(36)"`
+	KnowledgeBaseID uint   `gorm:"primaryKey"`
+}
+
+// Source 回答引用的资料，Index对应回答中的[n]
+type Source struct {
+	Index      int     `json:"index"`
+	DocumentID uint    `json:"documentId"`
+	FileName   string  `json:"fileName"`
+	Content    string  `json:"content"`
+	Score      float64 `json:"score"`
+}
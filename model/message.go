@@ -5,18 +5,43 @@ import (
 )
 
 type Message struct {
-	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	SessionID string    `gorm:"index;not null;type:varchar(36)" json:"session_id"`
-	UserName  string    `gorm:"type:varchar(20)" json:"username"` //type为数据库列类型
-	Content   string    `gorm:"type:text" json:"content"`
-	IsUser    bool      `gorm:"not null;" json:"is_user"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID string `gorm:"index;type:varchar(36)" json:"message_id"` //应用侧生成的消息ID，消息异步入库，编辑、重新生成时用它定位消息
+	ParentID  string `gorm:"index;type:varchar(36)" json:"parent_id"`  //父消息的MessageID，为空表示会话的第一条消息（消息树的根）
+	SessionID string `gorm:"index;not null;type:varchar(36)" json:"session_id"`
+	UserName  string `gorm:"index;type:varchar(20)" json:"username"` //type为数据库列类型
+	//全文索引用ngram分词，支持中文关键词搜索
+	Content string `gorm:"type:text;index:idx_messages_content,class:FULLTEXT,option:WITH PARSER ngram" json:"content"`
+	IsUser  bool   `gorm:"not null;" json:"is_user"`
+	//工具调用相关：助手发起调用时ToolCalls记录调用列表（JSON），工具返回结果时ToolCallID和ToolName标识对应的调用
+	ToolCalls  string `gorm:"type:text" json:"tool_calls,omitempty"`
+	ToolCallID string `gorm:"type:varchar(64)" json:"tool_call_id,omitempty"`
+	ToolName   string `gorm:"type:varchar(64)" json:"tool_name,omitempty"`
+	ModelID    string `gorm:"type:varchar(50)" json:"model_id,omitempty"` //实际生成该回复的模型（故障转移时为作答的后端）
+	//用量统计（只有模型生成的消息才有）
+	PromptTokens     int       `gorm:"not null;default:0" json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `gorm:"not null;default:0" json:"completion_tokens,omitempty"`
+	TotalTokens      int       `gorm:"not null;default:0" json:"total_tokens,omitempty"`
+	LatencyMs        int64     `gorm:"not null;default:0" json:"latency_ms,omitempty"`    //模型调用耗时（毫秒）
+	Truncated        bool      `gorm:"not null;default:false" json:"truncated,omitempty"` //生成被中途停止，内容不完整
+	Sources          string    `gorm:"type:text" json:"sources,omitempty"`                //回答引用的知识库资料（JSON）
+	Attachments      string    `gorm:"type:text" json:"attachments,omitempty"`            //用户消息附带的图片（JSON）
+	CreatedAt        time.Time `json:"created_at"`
 	//struct tag不会被编译器看见，而是由“使用这个struct的库”去解析
 }
 
 // json用于在序列化和反序列化时，告知字段名用什么
 // gorm用于定义数据库映射规则
 type History struct {
-	IsUser  bool   `json:"is_user"`
-	Content string `json:"content"`
+	MessageID string   `json:"message_id"`
+	ParentID  string   `json:"parent_id,omitempty"`
+	IsUser    bool     `json:"is_user"`
+	Content   string   `json:"content"`
+	Truncated bool     `json:"truncated,omitempty"`
+	Sources   []Source `json:"sources,omitempty"`
+	//用户消息附带的图片，通过附件接口获取内容
+	Attachments []Attachment `json:"attachments,omitempty"`
+	//同一位置的其他版本（编辑或重新生成产生的分支），前端据此显示“< 2/3 >”并切换
+	SiblingIDs   []string `json:"sibling_ids,omitempty"`
+	SiblingIndex int      `json:"sibling_index"`
 }
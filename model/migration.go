@@ -0,0 +1,11 @@
+package model
+
+import (
+	"time"
+)
+
+// Migration 已经执行过的一次性数据迁移，启动时跳过
+type Migration struct {
+	Name      string    `gorm:"primaryKey;type:varchar(100)"`
+	CreatedAt time.Time //执行完成的时间
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Persona 助手人设：通过系统提示词定制助手的角色和回答风格，可在多个会话中复用
+type Persona struct {
+	ID           uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserName     string         `gorm:"index;not null;type:varchar(20)" json:"username"` //创建者
+	Name         string         `gorm:"type:varchar(50);not null" json:"name"`
+	SystemPrompt string         `gorm:"type:text" json:"systemPrompt"`
+	ModelType    string         `gorm:"type:varchar(50)" json:"modelType"` //默认使用的模型
+	Temperature  *float32       `json:"temperature,omitempty"`             //为空时使用模型默认值
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
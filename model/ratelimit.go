@@ -0,0 +1,15 @@
+package model
+
+// UserLimit 用户实际生效的限额（0表示不限制）
+type UserLimit struct {
+	RequestsPerMinute    int   `json:"requestsPerMinute"`
+	MaxConcurrentStreams int   `json:"maxConcurrentStreams"`
+	DailyTokens          int64 `json:"dailyTokens"`
+}
+
+// LimitOverride 管理员为某个用户单独设置的限额，未设置的字段沿用默认配置
+type LimitOverride struct {
+	RequestsPerMinute    *int   `json:"requestsPerMinute,omitempty"`
+	MaxConcurrentStreams *int   `json:"maxConcurrentStreams,omitempty"`
+	DailyTokens          *int64 `json:"dailyTokens,omitempty"`
+}
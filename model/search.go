@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// SearchResult 聊天记录搜索命中的一条消息，通过SessionID和MessageID定位到会话中的位置
+type SearchResult struct {
+	SessionID    string    `json:"sessionId"`
+	SessionTitle string    `json:"sessionTitle"`
+	MessageID    string    `json:"messageId"`
+	IsUser       bool      `json:"isUser"`
+	ModelID      string    `json:"modelId,omitempty"`
+	Snippet      string    `json:"snippet"`   //HTML转义后的内容片段，命中的关键词用<mark>包裹
+	Score        float64   `json:"score"`     //相关度，只用于排序
+	MatchType    string    `json:"matchType"` //keyword（关键词）/ semantic（语义）/ hybrid（两者都命中）
+	CreatedAt    time.Time `json:"createdAt"`
+}
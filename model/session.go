@@ -16,10 +16,40 @@ type Session struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	//软删除，给deleted_at字段赋值时间，正常查询时自动过滤掉
 	//json:"-"表示JSON序列化时忽略该字段
+
+	//标题是否已经生成过（或被用户手动修改过），为true时不再自动生成
+	TitleGenerated bool `gorm:"not null;default:false" json:"-"`
+
+	//会话使用的模型（配置中的模型id），从数据库恢复会话时按它创建模型
+	ModelType string `gorm:"type:varchar(50)" json:"model_type"`
+
+	//会话使用的人设，0表示不使用人设
+	PersonaID uint `gorm:"not null;default:0" json:"persona_id"`
+
+	//会话的生成参数，为空时使用人设或模型的默认值
+	Temperature *float32 `json:"temperature,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+
+	//滚动摘要：当前分支上直到SummarizedUntil（含）的消息已被压缩进Summary，构造上下文时用摘要代替它们
+	Summary         string `gorm:"type:text" json:"-"`
+	SummarizedUntil string `gorm:"type:varchar(36)" json:"-"`
+
+	//置顶的会话排在列表最前面，归档的会话不出现在默认列表中
+	Pinned   bool `gorm:"not null;default:false" json:"pinned"`
+	Archived bool `gorm:"not null;default:false" json:"archived"`
+
+	//会话是一棵消息树，ActiveLeafID为当前所在分支的最后一条消息
+	ActiveLeafID string `gorm:"type:varchar(36)" json:"active_leaf_id,omitempty"`
 }
 
 // 接口返回模型
 type SessionInfo struct {
-	SessionID string `json:"sessionId"`
-	Title     string `json:"name"`
+	SessionID string    `json:"sessionId"`
+	Title     string    `json:"name"`
+	ModelType string    `json:"modelType"`
+	Pinned    bool      `json:"pinned"`
+	Archived  bool      `json:"archived"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 } //不是数据库表模型，更贴近前端使用
@@ -0,0 +1,12 @@
+package model
+
+// UsageStat 用量统计（不是数据库表模型，由messages表聚合得到）
+type UsageStat struct {
+	Date             string  `json:"date,omitempty"` //按天聚合时的日期，格式2006-01-02
+	ModelID          string  `json:"modelId"`
+	Requests         int64   `json:"requests"` //模型调用次数
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens"`
+	Cost             float64 `json:"cost" gorm:"-"` //按价格表估算的费用
+}
@@ -1,7 +1,17 @@
 package router
 
 import (
+	"GopherAI/controller/admin"
+	"GopherAI/controller/aimodel"
+	"GopherAI/controller/attachment"
+	"GopherAI/controller/knowledge"
+	"GopherAI/controller/persona"
+	"GopherAI/controller/search"
 	"GopherAI/controller/session"
+	"GopherAI/controller/transfer"
+	"GopherAI/controller/usage"
+	"GopherAI/controller/ws"
+	"GopherAI/middleware/ratelimit"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,16 +19,82 @@ import (
 func AIRouter(r *gin.RouterGroup) {
 	//聊天相关接口
 	{
-		//获取用户所有会话
+		//分页获取用户的会话
 		r.GET("/chat/sessions", session.GetUserSessionsByUserName)
 		//创建新会话并发送消息
-		r.POST("/chat/send-new-session", session.CreateSessionAndSendMessage)
+		r.POST("/chat/send-new-session", ratelimit.Limit(), session.CreateSessionAndSendMessage)
 		//在已创建的会话上发送消息
-		r.POST("/chat/send", session.ChatSend)
+		r.POST("/chat/send", ratelimit.Limit(), session.ChatSend)
 		//获取一次会话中的所有信息
 		r.POST("/chat/history", session.ChatHistory)
 		//创建流式输出会话
-		r.POST("/chat/send-stream-new-session", session.CreateStreamSessionAndSendMessage)
-		r.POST("/chat/send-stream", session.ChatStreamSend)
+		r.POST("/chat/send-stream-new-session", ratelimit.StreamLimit(), session.CreateStreamSessionAndSendMessage)
+		r.POST("/chat/send-stream", ratelimit.StreamLimit(), session.ChatStreamSend)
+		//重新生成最后一次回答
+		r.POST("/chat/regenerate", ratelimit.Limit(), session.Regenerate)
+		r.POST("/chat/regenerate-stream", ratelimit.StreamLimit(), session.RegenerateStream)
+		//修改之前的问题并重新回答
+		r.POST("/chat/edit", ratelimit.Limit(), session.EditMessage)
+		r.POST("/chat/edit-stream", ratelimit.StreamLimit(), session.EditMessageStream)
+		//切换到消息的其他版本（分支）
+		r.POST("/chat/switch-branch", session.SwitchBranch)
+		//WebSocket聊天：一个连接上收发多个会话的消息和事件
+		r.GET("/ws", ws.Chat)
+		//断线后续传流式输出（带上Last-Event-ID）
+		r.GET("/chat/stream/:generationId", session.ResumeStream)
+		//停止正在进行的生成
+		r.POST("/chat/stop", session.StopGeneration)
+		//修改会话：重命名、置顶、归档，中途切换模型、人设、生成参数
+		r.PATCH("/sessions/:id", session.UpdateSession)
+		//删除（软删除）和恢复会话
+		r.DELETE("/sessions/:id", session.DeleteSession)
+		r.POST("/sessions/:id/restore", session.RestoreSession)
+		//导出会话（单个 / 全部打包成zip）和导入会话
+		r.GET("/sessions/:id/export", transfer.ExportSession)
+		r.GET("/sessions/export", transfer.ExportAllSessions)
+		r.POST("/sessions/import", transfer.ImportSessions)
+	}
+	//搜索聊天记录（关键词 / 语义）
+	r.GET("/search", search.Search)
+	//聊天图片：先上传，发送消息时通过attachmentIds引用
+	{
+		r.POST("/attachments", attachment.UploadAttachment)
+		r.GET("/attachments/:id", attachment.GetAttachment)
+	}
+	//获取可用模型列表
+	r.GET("/models", aimodel.ListModels)
+	//人设相关接口
+	{
+		r.GET("/personas", persona.ListPersonas)
+		r.POST("/personas", persona.CreatePersona)
+		r.GET("/personas/:id", persona.GetPersona)
+		r.PUT("/personas/:id", persona.UpdatePersona)
+		r.DELETE("/personas/:id", persona.DeletePersona)
+	}
+	//知识库相关接口
+	{
+		r.GET("/knowledge-bases", knowledge.ListKnowledgeBases)
+		r.POST("/knowledge-bases", knowledge.CreateKnowledgeBase)
+		r.DELETE("/knowledge-bases/:id", knowledge.DeleteKnowledgeBase)
+		r.GET("/knowledge-bases/:id/documents", knowledge.ListDocuments)
+		r.POST("/knowledge-bases/:id/documents", knowledge.UploadDocument)
+		r.DELETE("/knowledge-bases/:id/documents/:docId", knowledge.DeleteDocument)
+		//会话挂载的知识库
+		r.GET("/sessions/:id/knowledge-bases", knowledge.GetSessionKnowledgeBases)
+		r.PUT("/sessions/:id/knowledge-bases", knowledge.SetSessionKnowledgeBases)
+	}
+	//用量统计接口
+	{
+		r.GET("/usage/daily", usage.DailyUsage)
+		r.GET("/usage/models", usage.ModelUsage)
+		r.GET("/usage/sessions/:id", usage.SessionUsage)
+	}
+	//管理员接口：调整用户限额
+	{
+		adminGroup := r.Group("/admin")
+		adminGroup.Use(ratelimit.AdminOnly())
+		adminGroup.GET("/limits/:userName", admin.GetUserLimit)
+		adminGroup.PUT("/limits/:userName", admin.SetUserLimit)
+		adminGroup.DELETE("/limits/:userName", admin.DeleteUserLimit)
 	}
 }
@@ -5,12 +5,13 @@ package router
 
 import (
 	"GopherAI/controller/image"
+	"GopherAI/middleware/ratelimit"
 
 	"github.com/gin-gonic/gin"
 )
 
 func ImageRouter(r *gin.RouterGroup) {
-	r.POST("/recognize", image.RecognizeImage)
+	r.POST("/recognize", ratelimit.Limit(), image.RecognizeImage)
 }
 
 //1.HTTP的常见方法：GET（获取数据），POST（提交数据）
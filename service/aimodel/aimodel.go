@@ -0,0 +1,10 @@
+package aimodel //可用模型查询
+
+import (
+	"GopherAI/common/aihelper"
+)
+
+// 获取所有可用模型，数据来源是配置文件中的[[models]]
+func ListModels() []aihelper.ModelInfo {
+	return aihelper.GetGlobalFactory().ListModels()
+}
@@ -0,0 +1,124 @@
+package attachment //聊天图片上传与读取
+
+import (
+	"GopherAI/common/attachment"
+	"GopherAI/common/code"
+	"GopherAI/config"
+	attachmentdao "GopherAI/dao/attachment" //与common/attachment重名，起别名
+	"GopherAI/model"
+	"GopherAI/service/image"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMaxSizeMB = 5
+	defaultMaxCount  = 4
+)
+
+// 支持发给模型的图片格式
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// UploadAttachment 保存用户上传的图片，按配置用本地模型分类作为提示标签
+func UploadAttachment(userName string, fileName string, data []byte) (*model.Attachment, code.Code) {
+	conf := config.GetConfig().AttachmentConfig
+	maxMB := conf.MaxSizeMB
+	if maxMB <= 0 {
+		maxMB = defaultMaxSizeMB
+	}
+	if int64(len(data)) > int64(maxMB)<<20 {
+		return nil, code.CodeFileTooLarge
+	}
+	//按文件内容判断类型，不信任扩展名
+	mimeType := http.DetectContentType(data)
+	if !allowedTypes[mimeType] {
+		return nil, code.CodeUnsupportedFile
+	}
+
+	att := &model.Attachment{
+		ID:       uuid.New().String(),
+		UserName: userName,
+		FileName: fileName,
+		MIMEType: mimeType,
+		Size:     int64(len(data)),
+	}
+	if conf.ClassifyHint {
+		label, err := image.RecognizeBytes(data)
+		if err != nil {
+			log.Println("UploadAttachment RecognizeBytes error:", err) //分类失败不影响上传
+		} else {
+			att.Label = label
+		}
+	}
+
+	if err := attachment.Save(att.ID, data); err != nil {
+		log.Println("UploadAttachment Save error:", err)
+		return nil, code.CodeServerBusy
+	}
+	if _, err := attachmentdao.CreateAttachment(att); err != nil {
+		log.Println("UploadAttachment CreateAttachment error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return att, code.CodeSuccess
+}
+
+// GetAttachment 获取图片元数据和内容
+func GetAttachment(userName string, id string) (*model.Attachment, []byte, code.Code) {
+	att, err := attachmentdao.GetAttachmentByID(userName, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, code.CodeRecordNotFound
+	}
+	if err != nil {
+		log.Println("GetAttachment error:", err)
+		return nil, nil, code.CodeServerBusy
+	}
+	data, err := attachment.Load(att.ID)
+	if err != nil {
+		log.Println("GetAttachment Load error:", err)
+		return nil, nil, code.CodeRecordNotFound
+	}
+	return att, data, code.CodeSuccess
+}
+
+// ResolveAttachments 校验发送消息时引用的图片都属于该用户，按请求顺序返回
+func ResolveAttachments(userName string, ids []string) ([]model.Attachment, code.Code) {
+	if len(ids) == 0 {
+		return nil, code.CodeSuccess
+	}
+	maxCount := config.GetConfig().AttachmentConfig.MaxCount
+	if maxCount <= 0 {
+		maxCount = defaultMaxCount
+	}
+	if len(ids) > maxCount {
+		return nil, code.CodeInvalidParams
+	}
+
+	atts, err := attachmentdao.GetAttachmentsByIDs(userName, ids)
+	if err != nil {
+		log.Println("ResolveAttachments error:", err)
+		return nil, code.CodeServerBusy
+	}
+	byID := make(map[string]model.Attachment, len(atts))
+	for _, att := range atts {
+		byID[att.ID] = att
+	}
+	out := make([]model.Attachment, 0, len(ids))
+	for _, id := range ids {
+		att, ok := byID[strings.TrimSpace(id)]
+		if !ok {
+			return nil, code.CodeRecordNotFound
+		}
+		out = append(out, att)
+	}
+	return out, code.CodeSuccess
+}
@@ -9,6 +9,24 @@ import (
 
 // 为HTTP层服务的，不是底层推理层
 func RecognizeImage(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open() //multipart.FileHeader只是元数据，真正的数据需要Open()
+	if err != nil {
+		log.Println("file open fail err is : ", err)
+		return "", err
+	}
+	defer src.Close() //关闭文件
+
+	buf, err := io.ReadAll(src) //读取文件，得到原始图片数据
+	if err != nil {
+		log.Println("io.ReadAll fail err is : ", err)
+		return "", err
+	}
+
+	return RecognizeBytes(buf)
+}
+
+// RecognizeBytes 对图片数据进行分类（聊天图片的提示标签也走这里）
+func RecognizeBytes(buf []byte) (string, error) {
 
 	modelPath := "/root/models/mobilenetv2/mobilenetv2-7.onnx"
 	//指向ONNX模型文件，模型为MobileNetV2
@@ -24,18 +42,5 @@ func RecognizeImage(file *multipart.FileHeader) (string, error) {
 	}
 	defer recognizer.Close() //防止内存泄漏（持有系统资源）
 
-	src, err := file.Open() //multipart.FileHeader只是元数据，真正的数据需要Open()
-	if err != nil {
-		log.Println("file open fail err is : ", err)
-		return "", err
-	}
-	defer src.Close() //关闭文件
-
-	buf, err := io.ReadAll(src) //读取文件，得到原始图片数据
-	if err != nil {
-		log.Println("io.ReadAll fail err is : ", err)
-		return "", err
-	}
-
 	return recognizer.PredictFromBuffer(buf) //从图片数据预测
 }
@@ -0,0 +1,256 @@
+package knowledge //知识库管理 + 文档解析、切片、向量化
+
+import (
+	"GopherAI/common/aihelper"
+	"GopherAI/common/code"
+	"GopherAI/common/rag"
+	"GopherAI/config"
+	"GopherAI/dao/knowledge"
+	"GopherAI/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+func GetKnowledgeBases(userName string) ([]model.KnowledgeBase, code.Code) {
+	kbs, err := knowledge.GetKnowledgeBasesByUserName(userName)
+	if err != nil {
+		log.Println("GetKnowledgeBases error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return kbs, code.CodeSuccess
+}
+
+func GetKnowledgeBase(userName string, id uint) (*model.KnowledgeBase, code.Code) {
+	kb, err := knowledge.GetKnowledgeBaseByID(userName, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, code.CodeRecordNotFound
+	}
+	if err != nil {
+		log.Println("GetKnowledgeBase error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return kb, code.CodeSuccess
+}
+
+func CreateKnowledgeBase(userName string, name string, description string) (*model.KnowledgeBase, code.Code) {
+	kb, err := knowledge.CreateKnowledgeBase(&model.KnowledgeBase{
+		UserName:    userName,
+		Name:        name,
+		Description: description,
+	})
+	if err != nil {
+		log.Println("CreateKnowledgeBase error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return kb, code.CodeSuccess
+}
+
+func DeleteKnowledgeBase(userName string, id uint) code.Code {
+	rows, err := knowledge.DeleteKnowledgeBase(userName, id)
+	if err != nil {
+		log.Println("DeleteKnowledgeBase error:", err)
+		return code.CodeServerBusy
+	}
+	if rows == 0 {
+		return code.CodeRecordNotFound
+	}
+	if err := rag.RemoveKnowledgeBase(context.Background(), id); err != nil {
+		log.Println("DeleteKnowledgeBase RemoveKnowledgeBase error:", err)
+	}
+
+	//从内存中挂载了该知识库的会话上摘掉
+	manager := aihelper.GetGlobalManager()
+	for _, sessionID := range manager.GetUserSessions(userName) {
+		helper, ok := manager.GetAIHelper(userName, sessionID)
+		if !ok {
+			continue
+		}
+		ids := helper.GetKnowledgeBases()
+		if i := slices.Index(ids, id); i >= 0 {
+			helper.SetKnowledgeBases(slices.Delete(ids, i, i+1))
+		}
+	}
+	manager.InvalidateUser(userName)
+	return code.CodeSuccess
+}
+
+func GetDocuments(userName string, knowledgeBaseID uint) ([]model.Document, code.Code) {
+	if _, code_ := GetKnowledgeBase(userName, knowledgeBaseID); code_ != code.CodeSuccess {
+		return nil, code_
+	}
+	docs, err := knowledge.GetDocuments(knowledgeBaseID)
+	if err != nil {
+		log.Println("GetDocuments error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return docs, code.CodeSuccess
+}
+
+// UploadDocument 保存文档记录后在后台解析、切片、向量化，前端通过文档列表查看处理状态
+func UploadDocument(userName string, knowledgeBaseID uint, fileName string, data []byte) (*model.Document, code.Code) {
+	if _, code_ := GetKnowledgeBase(userName, knowledgeBaseID); code_ != code.CodeSuccess {
+		return nil, code_
+	}
+	if !rag.SupportedFile(fileName) {
+		return nil, code.CodeUnsupportedFile
+	}
+	if maxMB := config.GetConfig().RAGConfig.MaxFileSizeMB; maxMB > 0 && int64(len(data)) > int64(maxMB)<<20 {
+		return nil, code.CodeFileTooLarge
+	}
+
+	doc, err := knowledge.CreateDocument(&model.Document{
+		KnowledgeBaseID: knowledgeBaseID,
+		UserName:        userName,
+		FileName:        fileName,
+		Size:            int64(len(data)),
+		Status:          model.DocumentProcessing,
+	})
+	if err != nil {
+		log.Println("UploadDocument CreateDocument error:", err)
+		return nil, code.CodeServerBusy
+	}
+
+	go processDocument(*doc, data)
+	return doc, code.CodeSuccess
+}
+
+// 处理过程中文档或知识库被删除
+var errDocumentDeleted = errors.New("document deleted")
+
+// 解析、切片、向量化并写入索引，失败时记录原因
+func processDocument(doc model.Document, data []byte) {
+	count, err := indexDocument(context.Background(), doc, data)
+	if errors.Is(err, errDocumentDeleted) {
+		log.Printf("processDocument %d: document deleted during processing, discarded\n", doc.ID)
+		return
+	}
+	status, errMsg := model.DocumentReady, ""
+	if err != nil {
+		log.Printf("processDocument %d error: %v\n", doc.ID, err)
+		status, errMsg = model.DocumentFailed, err.Error()
+		if len(errMsg) > 255 {
+			errMsg = errMsg[:255]
+		}
+	}
+	if err := knowledge.UpdateDocumentStatus(doc.ID, status, count, errMsg); err != nil {
+		log.Println("processDocument UpdateDocumentStatus error:", err)
+	}
+}
+
+func indexDocument(ctx context.Context, doc model.Document, data []byte) (int, error) {
+	text, err := rag.ExtractText(doc.FileName, data)
+	if err != nil {
+		return 0, err
+	}
+	conf := config.GetConfig().RAGConfig
+	pieces := rag.SplitText(text, conf.ChunkSize, conf.ChunkOverlap)
+	if len(pieces) == 0 {
+		return 0, errors.New("no text found in document")
+	}
+
+	vectors, err := rag.EmbedTexts(ctx, pieces)
+	if err != nil {
+		return 0, err
+	}
+
+	chunks := make([]model.Chunk, 0, len(pieces))
+	for i, piece := range pieces {
+		vec, err := json.Marshal(vectors[i])
+		if err != nil {
+			return 0, err
+		}
+		chunks = append(chunks, model.Chunk{
+			KnowledgeBaseID: doc.KnowledgeBaseID,
+			DocumentID:      doc.ID,
+			Seq:             i,
+			Content:         piece,
+			Embedding:       string(vec),
+		})
+	}
+	//向量化耗时较长，期间文档可能被删除，写入前在同一事务里确认文档还在
+	exists, err := knowledge.CreateDocumentChunks(doc.ID, chunks)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, errDocumentDeleted
+	}
+	if err := rag.AddChunks(ctx, chunks, vectors); err != nil {
+		return 0, err
+	}
+	//写入索引前文档被删除时，删除操作清不到这些向量，这里补删
+	if exists, err := knowledge.DocumentExists(doc.ID); err == nil && !exists {
+		if err := rag.RemoveDocument(ctx, doc.ID); err != nil {
+			log.Printf("indexDocument RemoveDocument %d error: %v\n", doc.ID, err)
+		}
+		return 0, errDocumentDeleted
+	}
+	return len(chunks), nil
+}
+
+func DeleteDocument(userName string, knowledgeBaseID uint, id uint) code.Code {
+	if _, code_ := GetKnowledgeBase(userName, knowledgeBaseID); code_ != code.CodeSuccess {
+		return code_
+	}
+	rows, err := knowledge.DeleteDocument(knowledgeBaseID, id)
+	if err != nil {
+		log.Println("DeleteDocument error:", err)
+		return code.CodeServerBusy
+	}
+	if rows == 0 {
+		return code.CodeRecordNotFound
+	}
+	if err := rag.RemoveDocument(context.Background(), id); err != nil {
+		log.Println("DeleteDocument RemoveDocument error:", err)
+	}
+	return code.CodeSuccess
+}
+
+// 获取会话挂载的知识库
+func GetSessionKnowledgeBases(userName string, sessionID string) ([]uint, code.Code) {
+	helper, ok := aihelper.GetGlobalManager().GetAIHelper(userName, sessionID)
+	if !ok {
+		return nil, code.CodeRecordNotFound
+	}
+	return helper.GetKnowledgeBases(), code.CodeSuccess
+}
+
+// SetSessionKnowledgeBases 设置会话挂载的知识库（整体替换），只能挂载自己的知识库
+func SetSessionKnowledgeBases(userName string, sessionID string, ids []uint) code.Code {
+	helper, ok := aihelper.GetGlobalManager().GetAIHelper(userName, sessionID)
+	if !ok {
+		return code.CodeRecordNotFound
+	}
+	code_ := AttachKnowledgeBases(userName, helper, ids)
+	if code_ == code.CodeSuccess {
+		aihelper.GetGlobalManager().Invalidate(userName, sessionID)
+	}
+	return code_
+}
+
+// AttachKnowledgeBases 校验知识库归属后挂载到会话上（新建会话时也会调用）
+func AttachKnowledgeBases(userName string, helper *aihelper.AIHelper, ids []uint) code.Code {
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) > 0 {
+		n, err := knowledge.CountKnowledgeBases(userName, ids)
+		if err != nil {
+			log.Println("AttachKnowledgeBases CountKnowledgeBases error:", err)
+			return code.CodeServerBusy
+		}
+		if n != int64(len(ids)) {
+			return code.CodeRecordNotFound
+		}
+	}
+	if err := knowledge.SetSessionKnowledgeBases(helper.SessionID, ids); err != nil {
+		log.Println("AttachKnowledgeBases SetSessionKnowledgeBases error:", err)
+		return code.CodeServerBusy
+	}
+	helper.SetKnowledgeBases(ids)
+	return code.CodeSuccess
+}
@@ -0,0 +1,92 @@
+package persona //助手人设的增删改查
+
+import (
+	"GopherAI/common/aihelper"
+	"GopherAI/common/code"
+	"GopherAI/dao/persona"
+	"GopherAI/model"
+	"errors"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+func GetPersonas(userName string) ([]model.Persona, code.Code) {
+	personas, err := persona.GetPersonasByUserName(userName)
+	if err != nil {
+		log.Println("GetPersonas error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return personas, code.CodeSuccess
+}
+
+func GetPersona(userName string, id uint) (*model.Persona, code.Code) {
+	p, err := persona.GetPersonaByID(userName, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, code.CodeRecordNotFound
+	}
+	if err != nil {
+		log.Println("GetPersona error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return p, code.CodeSuccess
+}
+
+func CreatePersona(userName string, p *model.Persona) (*model.Persona, code.Code) {
+	p.ID = 0
+	p.UserName = userName
+	created, err := persona.CreatePersona(p)
+	if err != nil {
+		log.Println("CreatePersona error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return created, code.CodeSuccess
+}
+
+func UpdatePersona(userName string, id uint, p *model.Persona) (*model.Persona, code.Code) {
+	existing, code_ := GetPersona(userName, id)
+	if code_ != code.CodeSuccess {
+		return nil, code_
+	}
+
+	existing.Name = p.Name
+	existing.SystemPrompt = p.SystemPrompt
+	existing.ModelType = p.ModelType
+	existing.Temperature = p.Temperature
+	if err := persona.UpdatePersona(existing); err != nil {
+		log.Println("UpdatePersona error:", err)
+		return nil, code.CodeServerBusy
+	}
+	refreshHelpers(userName, existing.ID, existing)
+	return existing, code.CodeSuccess
+}
+
+func DeletePersona(userName string, id uint) code.Code {
+	rows, err := persona.DeletePersona(userName, id)
+	if err != nil {
+		log.Println("DeletePersona error:", err)
+		return code.CodeServerBusy
+	}
+	if rows == 0 {
+		return code.CodeRecordNotFound
+	}
+	refreshHelpers(userName, id, nil)
+	return code.CodeSuccess
+}
+
+// 人设修改或删除后，同步到内存中正在使用该人设的AIHelper（p为nil表示人设已删除）
+func refreshHelpers(userName string, id uint, p *model.Persona) {
+	manager := aihelper.GetGlobalManager()
+	for _, sessionID := range manager.GetUserSessions(userName) {
+		helper, ok := manager.GetAIHelper(userName, sessionID)
+		if !ok || helper.GetPersonaID() != id {
+			continue
+		}
+		if p == nil {
+			helper.SetPersona(0, "", nil)
+		} else {
+			helper.SetPersona(p.ID, p.SystemPrompt, p.Temperature)
+		}
+	}
+	manager.InvalidateUser(userName)
+}
@@ -0,0 +1,90 @@
+package ratelimit //用户限额的查询与管理
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/common/redis"
+	"GopherAI/config"
+	"GopherAI/model"
+	"encoding/json"
+	"log"
+)
+
+// 默认限额
+func defaultLimit() model.UserLimit {
+	conf := config.GetConfig().RateLimitConfig
+	return model.UserLimit{
+		RequestsPerMinute:    conf.RequestsPerMinute,
+		MaxConcurrentStreams: conf.MaxConcurrentStreams,
+		DailyTokens:          conf.DailyTokens,
+	}
+}
+
+// 读取用户的单独限额，没有设置时返回nil
+func getOverride(userName string) (*model.LimitOverride, error) {
+	data, err := redis.GetLimitOverride(userName)
+	if err != nil || data == "" {
+		return nil, err
+	}
+	override := new(model.LimitOverride)
+	if err := json.Unmarshal([]byte(data), override); err != nil {
+		return nil, err
+	}
+	return override, nil
+}
+
+// GetEffectiveLimit 获取用户实际生效的限额：单独限额覆盖默认配置
+func GetEffectiveLimit(userName string) (model.UserLimit, error) {
+	limit := defaultLimit()
+	override, err := getOverride(userName)
+	if err != nil || override == nil {
+		return limit, err
+	}
+	if override.RequestsPerMinute != nil {
+		limit.RequestsPerMinute = *override.RequestsPerMinute
+	}
+	if override.MaxConcurrentStreams != nil {
+		limit.MaxConcurrentStreams = *override.MaxConcurrentStreams
+	}
+	if override.DailyTokens != nil {
+		limit.DailyTokens = *override.DailyTokens
+	}
+	return limit, nil
+}
+
+// GetUserLimit 查询用户的限额和当天已用token（管理员接口）
+func GetUserLimit(userName string) (model.UserLimit, *model.LimitOverride, int64, code.Code) {
+	limit, err := GetEffectiveLimit(userName)
+	if err != nil {
+		log.Println("GetUserLimit error:", err)
+		return limit, nil, 0, code.CodeServerBusy
+	}
+	override, _ := getOverride(userName)
+	used, err := redis.GetDailyTokens(userName)
+	if err != nil {
+		log.Println("GetUserLimit error:", err)
+		return limit, nil, 0, code.CodeServerBusy
+	}
+	return limit, override, used, code.CodeSuccess
+}
+
+// SetUserLimit 设置用户的单独限额
+func SetUserLimit(userName string, override *model.LimitOverride) code.Code {
+	data, err := json.Marshal(override)
+	if err != nil {
+		return code.CodeInvalidParams
+	}
+	if err := redis.SetLimitOverride(userName, string(data)); err != nil {
+		log.Println("SetUserLimit error:", err)
+		return code.CodeServerBusy
+	}
+	return code.CodeSuccess
+}
+
+// DeleteUserLimit 删除用户的单独限额
+func DeleteUserLimit(userName string) code.Code {
+	if err := redis.DeleteLimitOverride(userName); err != nil {
+		log.Println("DeleteUserLimit error:", err)
+		return code.CodeServerBusy
+	}
+	return code.CodeSuccess
+}
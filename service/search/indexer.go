@@ -0,0 +1,147 @@
+package search
+
+//后台把新消息向量化写入向量存储，供语义搜索使用
+//按消息自增ID推进进度，redis后端时进度保存在redis中，重启后接着处理；memory后端每次启动从头开始
+import (
+	"GopherAI/common/rag"
+	"GopherAI/common/redis"
+	"GopherAI/common/vectorstore"
+	"GopherAI/config"
+	"GopherAI/dao/message"
+	"GopherAI/model"
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+// 向量存储中消息的元数据字段
+const (
+	storeName    = "messages"
+	fieldUser    = "user_name"
+	fieldSession = "session_id"
+
+	maxEmbedRunes = 2000 //过长的消息只取开头部分向量化
+)
+
+// 消息向量所在的向量存储
+func getStore() (vectorstore.VectorStore, error) {
+	return vectorstore.Get(storeName, []string{fieldUser, fieldSession})
+}
+
+// 进度保存在redis中的key（只有redis后端需要）
+func watermarkKey() string {
+	conf := config.GetConfig().VectorStoreConfig
+	if conf.Backend != "redis" || redis.Rdb == nil {
+		return ""
+	}
+	prefix := conf.KeyPrefix
+	if prefix == "" {
+		prefix = "vector"
+	}
+	return prefix + ":" + storeName + ":watermark"
+}
+
+func loadWatermark(ctx context.Context) uint {
+	key := watermarkKey()
+	if key == "" {
+		return 0
+	}
+	v, err := redis.Rdb.Get(ctx, key).Result()
+	if err != nil {
+		return 0
+	}
+	id, _ := strconv.ParseUint(v, 10, 64)
+	return uint(id)
+}
+
+func saveWatermark(ctx context.Context, id uint) {
+	if key := watermarkKey(); key != "" {
+		if err := redis.Rdb.Set(ctx, key, id, 0).Err(); err != nil {
+			log.Println("search saveWatermark error:", err)
+		}
+	}
+}
+
+// StartIndexer 开启语义搜索时启动后台向量化任务（需在redis初始化之后调用）
+func StartIndexer() {
+	conf := config.GetConfig().SearchConfig
+	if !conf.Semantic {
+		return
+	}
+	batch := conf.IndexBatch
+	if batch <= 0 {
+		batch = 64
+	}
+	interval := time.Duration(conf.IndexIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ctx := context.Background()
+		watermark := loadWatermark(ctx)
+		log.Printf("Search indexer started from message %d", watermark)
+		for {
+			n, err := indexBatch(ctx, &watermark, batch)
+			if err != nil {
+				log.Println("search indexBatch error:", err)
+			}
+			if err != nil || n < batch {
+				time.Sleep(interval) //出错或已追上最新消息，等待一段时间再继续
+			}
+		}
+	}()
+}
+
+// 向量化watermark之后的一批消息，返回处理的条数
+func indexBatch(ctx context.Context, watermark *uint, batch int) (int, error) {
+	msgs, err := message.GetSearchableMessagesAfter(*watermark, batch)
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+	store, err := getStore()
+	if err != nil {
+		return 0, err
+	}
+
+	texts := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		texts = append(texts, clipRunes(m.Content, maxEmbedRunes))
+	}
+	vectors, err := rag.EmbedTexts(ctx, texts)
+	if err != nil {
+		return 0, err
+	}
+	if err := store.Upsert(ctx, toRecords(msgs, vectors)); err != nil {
+		return 0, err
+	}
+
+	*watermark = msgs[len(msgs)-1].ID
+	saveWatermark(ctx, *watermark)
+	return len(msgs), nil
+}
+
+// 消息向量只保存检索需要的元数据，内容从数据库回表获取
+func toRecords(msgs []model.Message, vectors [][]float64) []vectorstore.Record {
+	records := make([]vectorstore.Record, 0, len(msgs))
+	for i, m := range msgs {
+		records = append(records, vectorstore.Record{
+			ID:     m.MessageID,
+			Vector: vectors[i],
+			Metadata: map[string]string{
+				fieldUser:    m.UserName,
+				fieldSession: m.SessionID,
+			},
+		})
+	}
+	return records
+}
+
+func clipRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
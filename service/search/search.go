@@ -0,0 +1,257 @@
+package search //聊天记录搜索：关键词（MySQL全文索引）+ 语义（消息向量）
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/common/rag"
+	"GopherAI/common/vectorstore"
+	"GopherAI/config"
+	"GopherAI/dao/message"
+	"GopherAI/model"
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout       = "2006-01-02"
+	defaultPageSize  = 20
+	maxPageSize      = 50
+	rrfK             = 60 //混合检索按排名融合（RRF）的平滑常数
+	maxSemanticTopK  = 200
+	booleanOperators = `+-<>()~*"@`
+)
+
+// 搜索模式
+const (
+	ModeKeyword  = "keyword"
+	ModeSemantic = "semantic"
+	ModeHybrid   = "hybrid"
+)
+
+// Request 搜索条件
+type Request struct {
+	Query     string
+	Mode      string //keyword（默认）/ semantic / hybrid
+	From      string //开始日期，格式2006-01-02
+	To        string //结束日期（包含当天）
+	ModelID   string
+	SessionID string
+	Limit     int
+	Offset    int
+}
+
+// 解析查询中的关键词，去掉全文检索的运算符
+func parseTerms(query string) []string {
+	cleaned := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(booleanOperators, r) {
+			return ' '
+		}
+		return r
+	}, query)
+	return strings.Fields(cleaned)
+}
+
+// 每个关键词都必须出现，按短语匹配（ngram分词下中文词语按连续字匹配）
+func booleanQuery(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		parts = append(parts, `+"`+t+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// 解析过滤条件，日期按天，包含结束当天
+func parseOptions(req *Request) (message.SearchOptions, bool) {
+	opts := message.SearchOptions{ModelID: req.ModelID, SessionID: req.SessionID, Limit: req.Limit, Offset: req.Offset}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultPageSize
+	}
+	if opts.Limit > maxPageSize {
+		opts.Limit = maxPageSize
+	}
+	if opts.Offset < 0 {
+		return opts, false
+	}
+	if req.From != "" {
+		t, err := time.ParseInLocation(dateLayout, req.From, time.Local)
+		if err != nil {
+			return opts, false
+		}
+		opts.From = t
+	}
+	if req.To != "" {
+		t, err := time.ParseInLocation(dateLayout, req.To, time.Local)
+		if err != nil {
+			return opts, false
+		}
+		opts.To = t.AddDate(0, 0, 1)
+	}
+	return opts, opts.From.IsZero() || opts.To.IsZero() || opts.From.Before(opts.To)
+}
+
+// Search 搜索用户的聊天记录，结果按相关度排序
+func Search(ctx context.Context, userName string, req *Request) ([]model.SearchResult, code.Code) {
+	terms := parseTerms(req.Query)
+	if len(terms) == 0 {
+		return nil, code.CodeInvalidParams
+	}
+	opts, ok := parseOptions(req)
+	if !ok {
+		return nil, code.CodeInvalidParams
+	}
+	if req.Mode == "" {
+		req.Mode = ModeKeyword
+	}
+	if (req.Mode == ModeSemantic || req.Mode == ModeHybrid) && !config.GetConfig().SearchConfig.Semantic {
+		return nil, code.CodeFeatureDisabled
+	}
+
+	switch req.Mode {
+	case ModeKeyword:
+		hits, err := message.SearchMessages(userName, booleanQuery(terms), opts)
+		if err != nil {
+			log.Println("Search SearchMessages error:", err)
+			return nil, code.CodeServerBusy
+		}
+		return toResults(hits, terms, ModeKeyword), code.CodeSuccess
+	case ModeSemantic:
+		hits, err := semanticSearch(ctx, userName, req.Query, opts, opts.Offset+opts.Limit)
+		if err != nil {
+			log.Println("Search semanticSearch error:", err)
+			return nil, code.CodeServerBusy
+		}
+		return page(toResults(hits, terms, ModeSemantic), opts), code.CodeSuccess
+	case ModeHybrid:
+		return hybridSearch(ctx, userName, req.Query, terms, opts)
+	default:
+		return nil, code.CodeInvalidParams
+	}
+}
+
+// 语义检索：问题向量化后在用户的消息向量中找最相似的，再回表应用过滤条件
+func semanticSearch(ctx context.Context, userName string, query string, opts message.SearchOptions, want int) ([]message.MessageHit, error) {
+	store, err := getStore()
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := rag.EmbedTexts(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := vectorstore.Filter{fieldUser: {userName}}
+	if opts.SessionID != "" {
+		filter[fieldSession] = []string{opts.SessionID}
+	}
+	//回表时会过滤掉一部分（时间、模型、已删除的会话），多取一些
+	topK := want * 2
+	if topK > maxSemanticTopK {
+		topK = maxSemanticTopK
+	}
+	results, err := store.Query(ctx, vectors[0], topK, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	minScore := config.GetConfig().SearchConfig.MinScore
+	ids := make([]string, 0, len(results))
+	scores := make(map[string]float64, len(results))
+	for _, r := range results {
+		if r.Score < minScore {
+			continue
+		}
+		ids = append(ids, r.ID)
+		scores[r.ID] = r.Score
+	}
+
+	rows, err := message.GetMessageHits(userName, ids, message.SearchOptions{
+		From: opts.From, To: opts.To, ModelID: opts.ModelID, SessionID: opts.SessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Score = scores[rows[i].MessageID]
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Score > rows[j].Score })
+	return rows, nil
+}
+
+// 混合检索：关键词和语义各取一批，按排名融合后分页
+func hybridSearch(ctx context.Context, userName string, query string, terms []string, opts message.SearchOptions) ([]model.SearchResult, code.Code) {
+	want := opts.Offset + opts.Limit
+	keywordOpts := opts
+	keywordOpts.Offset, keywordOpts.Limit = 0, want
+	keywordHits, err := message.SearchMessages(userName, booleanQuery(terms), keywordOpts)
+	if err != nil {
+		log.Println("hybridSearch SearchMessages error:", err)
+		return nil, code.CodeServerBusy
+	}
+	semanticHits, err := semanticSearch(ctx, userName, query, opts, want)
+	if err != nil {
+		//语义检索失败时退化为关键词检索
+		log.Println("hybridSearch semanticSearch error:", err)
+	}
+
+	fused := make(map[string]*model.SearchResult)
+	var order []*model.SearchResult
+	add := func(hits []message.MessageHit, matchType string) {
+		for rank, h := range hits {
+			score := 1.0 / float64(rrfK+rank+1)
+			if r, ok := fused[h.MessageID]; ok {
+				r.Score += score
+				r.MatchType = ModeHybrid
+				continue
+			}
+			r := toResult(h, terms, matchType)
+			r.Score = score
+			fused[h.MessageID] = &r
+			order = append(order, &r)
+		}
+	}
+	add(keywordHits, ModeKeyword)
+	add(semanticHits, ModeSemantic)
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Score > order[j].Score })
+	results := make([]model.SearchResult, 0, len(order))
+	for _, r := range order {
+		results = append(results, *r)
+	}
+	return page(results, opts), code.CodeSuccess
+}
+
+// 取出当前页
+func page(results []model.SearchResult, opts message.SearchOptions) []model.SearchResult {
+	if opts.Offset >= len(results) {
+		return []model.SearchResult{}
+	}
+	end := opts.Offset + opts.Limit
+	if end > len(results) {
+		end = len(results)
+	}
+	return results[opts.Offset:end]
+}
+
+func toResults(hits []message.MessageHit, terms []string, matchType string) []model.SearchResult {
+	results := make([]model.SearchResult, 0, len(hits))
+	for _, h := range hits {
+		results = append(results, toResult(h, terms, matchType))
+	}
+	return results
+}
+
+func toResult(h message.MessageHit, terms []string, matchType string) model.SearchResult {
+	return model.SearchResult{
+		SessionID:    h.SessionID,
+		SessionTitle: h.SessionTitle,
+		MessageID:    h.MessageID,
+		IsUser:       h.IsUser,
+		ModelID:      h.ModelID,
+		Snippet:      snippet(h.Content, terms),
+		Score:        h.Score,
+		MatchType:    matchType,
+		CreatedAt:    h.CreatedAt,
+	}
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	snippetLength = 120 //片段长度（字符数）
+	snippetLead   = 30  //第一个命中位置之前保留的字符数
+)
+
+// 截取内容中第一个关键词附近的片段，HTML转义后用<mark>包裹命中的关键词
+// 没有命中关键词时（语义检索）取开头一段
+func snippet(content string, terms []string) string {
+	runes := []rune(content)
+	lower := make([]rune, len(runes)) //逐字转小写，保证下标与原文一致
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	needles := make([][]rune, 0, len(terms))
+	for _, t := range terms {
+		needles = append(needles, []rune(strings.ToLower(t)))
+	}
+
+	start := 0
+	if pos := indexAny(lower, needles, 0); pos > snippetLead {
+		start = pos - snippetLead
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		if n := matchAt(lower, needles, i); n > 0 {
+			if i+n > end {
+				n = end - i
+			}
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(string(runes[i : i+n])))
+			b.WriteString("</mark>")
+			i += n
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		i++
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// 从from开始第一个命中任意关键词的位置，没有命中返回-1
+func indexAny(text []rune, needles [][]rune, from int) int {
+	for i := from; i < len(text); i++ {
+		if matchAt(text, needles, i) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// 位置i处命中的最长关键词长度，没有命中返回0
+func matchAt(text []rune, needles [][]rune, i int) int {
+	best := 0
+	for _, n := range needles {
+		if len(n) <= best || i+len(n) > len(text) {
+			continue
+		}
+		if string(text[i:i+len(n)]) == string(n) {
+			best = len(n)
+		}
+	}
+	return best
+}
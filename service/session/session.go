@@ -3,143 +3,586 @@ package session //会话生命周期 + AIHelper调度 + HTTP/流式适配层
 import (
 	"GopherAI/common/aihelper"
 	"GopherAI/common/code"
+	"GopherAI/common/sse"
+	"GopherAI/config"
 	"GopherAI/dao/session"
 	"GopherAI/model"
+	"GopherAI/service/attachment"
+	"GopherAI/service/knowledge"
+	"GopherAI/service/persona"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"log"
-	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-var ctx = context.Background()
+// 会话标题的最大长度（字符数），与数据库字段长度一致
+const maxTitleLength = 100
 
-func GetUserSessionsByUserName(userName string) ([]model.SessionInfo, error) {
-	//获取用户的所有会话ID
+// 会话列表每页的默认条数和最大条数
+const (
+	defaultSessionPageSize = 20
+	maxSessionPageSize     = 100
+)
 
-	manager := aihelper.GetGlobalManager()
-	Sessions := manager.GetUserSessions(userName)
-	//数据来源是内存
+// ListSessions 分页获取用户的会话，数据来源是数据库（内存中只有最近访问过的会话）
+// sortBy为updated（默认）或created，cursor为上一页返回的nextCursor，返回的nextCursor为空表示没有更多
+func ListSessions(userName string, archived bool, deleted bool, sortBy string, limit int, cursor string) ([]model.SessionInfo, string, code.Code) {
+	opts := session.ListOptions{Archived: archived, Deleted: deleted, Limit: limit}
+	switch sortBy {
+	case "", "updated":
+		opts.SortBy = "updated_at"
+	case "created":
+		opts.SortBy = "created_at"
+	default:
+		return nil, "", code.CodeInvalidParams
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultSessionPageSize
+	}
+	if opts.Limit > maxSessionPageSize {
+		opts.Limit = maxSessionPageSize
+	}
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", code.CodeInvalidParams
+		}
+		opts.After = after
+	}
 
-	var SessionInfos []model.SessionInfo
+	sessions, err := session.ListSessions(userName, opts)
+	if err != nil {
+		log.Println("ListSessions error:", err)
+		return nil, "", code.CodeServerBusy
+	}
 
-	for _, session := range Sessions {
+	SessionInfos := make([]model.SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
 		SessionInfos = append(SessionInfos, model.SessionInfo{
-			SessionID: session,
-			Title:     session, // 暂时用sessionID作为标题，后续重构需要的时候可以更改
+			SessionID: sess.ID,
+			Title:     sess.Title,
+			ModelType: sess.ModelType,
+			Pinned:    sess.Pinned,
+			Archived:  sess.Archived,
+			CreatedAt: sess.CreatedAt,
+			UpdatedAt: sess.UpdatedAt,
 		})
 	}
 
-	return SessionInfos, nil
+	//取满一页时才可能还有下一页
+	nextCursor := ""
+	if len(sessions) == opts.Limit {
+		last := sessions[len(sessions)-1]
+		t := last.UpdatedAt
+		if opts.SortBy == "created_at" {
+			t = last.CreatedAt
+		}
+		nextCursor = encodeCursor(&session.Cursor{Pinned: last.Pinned, Time: t, ID: last.ID})
+	}
+	return SessionInfos, nextCursor, code.CodeSuccess
+}
+
+// 翻页位置对前端是不透明的字符串
+func encodeCursor(c *session.Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*session.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := new(session.Cursor)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// 截断过长的标题，避免超出数据库字段长度
+func truncateTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) <= maxTitleLength {
+		return title
+	}
+	return string([]rune(title)[:maxTitleLength])
+}
+
+// GetSession 获取用户的会话
+func GetSession(userName string, sessionID string) (*model.Session, code.Code) {
+	sess, err := session.GetUserSessionByID(userName, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, code.CodeRecordNotFound
+	}
+	if err != nil {
+		log.Println("GetSession error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return sess, code.CodeSuccess
+}
+
+// UpdateSessionMeta 重命名、置顶、归档会话，为nil的字段不修改
+func UpdateSessionMeta(userName string, sessionID string, title *string, pinned *bool, archived *bool) code.Code {
+	if _, code_ := GetSession(userName, sessionID); code_ != code.CodeSuccess {
+		return code_
+	}
+	columns := make(map[string]interface{})
+	if title != nil {
+		t := strings.TrimSpace(*title)
+		if t == "" || utf8.RuneCountInString(t) > maxTitleLength {
+			return code.CodeInvalidParams
+		}
+		columns["title"] = t
+		columns["title_generated"] = true //手动起的标题不再被自动生成覆盖
+	}
+	if pinned != nil {
+		columns["pinned"] = *pinned
+	}
+	if archived != nil {
+		columns["archived"] = *archived
+	}
+	if len(columns) == 0 {
+		return code.CodeSuccess
+	}
+	if err := session.UpdateSessionColumns(userName, sessionID, columns); err != nil {
+		log.Println("UpdateSessionMeta error:", err)
+		return code.CodeServerBusy
+	}
+	//只修改了会话的元数据，内存中的会话保留；手动起的标题同步到内存，避免再被自动生成
+	manager := aihelper.GetGlobalManager()
+	if helper, ok := manager.CachedAIHelper(userName, sessionID); ok && title != nil {
+		helper.SetTitled(true)
+	}
+	manager.Invalidate(userName, sessionID)
+	return code.CodeSuccess
 }
 
-func CreateSessionAndSendMessage(userName string, userQuestion string, modelType string) (string, string, code.Code) {
+// DeleteSession 软删除会话：停止会话上正在进行的生成，等它保存完后从内存中移除，之后可以恢复
+func DeleteSession(userName string, sessionID string) code.Code {
+	rows, err := session.DeleteSession(userName, sessionID)
+	if err != nil {
+		log.Println("DeleteSession error:", err)
+		return code.CodeServerBusy
+	}
+	if rows == 0 {
+		return code.CodeRecordNotFound
+	}
+	aihelper.StopGeneration(userName, "", sessionID)
+	//被停止的生成持有会话锁，拿到锁时截断的回答已经写入数据库
+	unlock, code_ := lockSession(context.Background(), userName, sessionID)
+	if code_ != code.CodeSuccess {
+		log.Printf("DeleteSession: session %s still busy, evict anyway\n", sessionID)
+		unlock = func() { aihelper.GetGlobalManager().Invalidate(userName, sessionID) }
+	}
+	defer unlock()
+	aihelper.GetGlobalManager().RemoveAIHelper(userName, sessionID)
+	return code.CodeSuccess
+}
+
+// RestoreSession 恢复已删除的会话，下次访问时从数据库加载
+func RestoreSession(userName string, sessionID string) code.Code {
+	rows, err := session.RestoreSession(userName, sessionID)
+	if err != nil {
+		log.Println("RestoreSession error:", err)
+		return code.CodeServerBusy
+	}
+	if rows == 0 {
+		return code.CodeRecordNotFound
+	}
+	//删除的会话不会放入内存，恢复后访问时从数据库加载
+	aihelper.GetGlobalManager().Invalidate(userName, sessionID)
+	return code.CodeSuccess
+}
+
+// 生成参数的取值范围
+func validParams(params aihelper.GenerationParams) bool {
+	if params.Temperature != nil && (*params.Temperature < 0 || *params.Temperature > 2) {
+		return false
+	}
+	if params.TopP != nil && (*params.TopP <= 0 || *params.TopP > 1) {
+		return false
+	}
+	return params.MaxTokens == nil || *params.MaxTokens > 0
+}
+
+// UpdateSessionConfig 修改会话的模型配置：modelType、personaID为nil表示不修改，params不为nil时整体替换生成参数
+// 修改写回数据库，并立即作用到内存中的AIHelper，下一次生成开始生效
+func UpdateSessionConfig(userName string, sessionID string, modelType *string, personaID *uint, params *aihelper.GenerationParams) code.Code {
+	unlock, code_ := lockSession(context.Background(), userName, sessionID)
+	if code_ != code.CodeSuccess {
+		return code_
+	}
+	defer unlock()
+
+	manager := aihelper.GetGlobalManager()
+	helper, exists := manager.GetAIHelper(userName, sessionID)
+	if !exists {
+		return code.CodeRecordNotFound
+	}
+	if params != nil && !validParams(*params) {
+		return code.CodeInvalidParams
+	}
+
+	updates := make(map[string]interface{})
+	if modelType != nil {
+		if _, ok := config.GetConfig().GetModelConfig(*modelType); !ok {
+			return code.AIModelNotFind
+		}
+		updates["model_type"] = *modelType
+	}
+	var p *model.Persona
+	if personaID != nil {
+		if *personaID != 0 {
+			var code_ code.Code
+			if p, code_ = persona.GetPersona(userName, *personaID); code_ != code.CodeSuccess {
+				return code_
+			}
+		}
+		updates["persona_id"] = *personaID
+	}
+	if params != nil {
+		updates["temperature"] = params.Temperature
+		updates["top_p"] = params.TopP
+		updates["max_tokens"] = params.MaxTokens
+	}
+
+	//先切换内存中的模型，切换失败时不写数据库，内存和数据库保持一致
+	factory := aihelper.GetGlobalFactory()
+	oldModelType := helper.GetModelType()
+	switched := modelType != nil && *modelType != oldModelType
+	if switched {
+		if err := factory.SwitchModel(context.Background(), helper, *modelType, nil); err != nil {
+			log.Println("UpdateSessionConfig SwitchModel error:", err)
+			return code.AIModelFail
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := session.UpdateSessionConfig(sessionID, updates); err != nil {
+			log.Println("UpdateSessionConfig error:", err)
+			if switched {
+				//数据库没有写入，切回原来的模型
+				if err := factory.SwitchModel(context.Background(), helper, oldModelType, nil); err != nil {
+					log.Println("UpdateSessionConfig SwitchModel back error:", err)
+				}
+			}
+			return code.CodeServerBusy
+		}
+	}
+
+	//同步到内存中的AIHelper
+	if personaID != nil {
+		if p != nil {
+			helper.SetPersona(p.ID, p.SystemPrompt, p.Temperature)
+		} else {
+			helper.SetPersona(0, "", nil)
+		}
+	}
+	if params != nil {
+		helper.SetParams(*params)
+	}
+	return code.CodeSuccess
+}
+
+// 解析请求中的人设，未指定模型时使用人设的默认模型
+func resolvePersona(userName string, personaID uint, modelType string) (*model.Persona, string, code.Code) {
+	if personaID == 0 {
+		if modelType == "" {
+			return nil, "", code.CodeInvalidParams
+		}
+		return nil, modelType, code.CodeSuccess
+	}
+	p, code_ := persona.GetPersona(userName, personaID)
+	if code_ != code.CodeSuccess {
+		return nil, "", code_
+	}
+	if modelType == "" {
+		modelType = p.ModelType
+	}
+	if modelType == "" {
+		return nil, "", code.CodeInvalidParams
+	}
+	return p, modelType, code.CodeSuccess
+}
+
+// 创建会话记录，并创建绑定了人设、挂载了知识库的AIHelper
+func createSessionWithHelper(userName string, userQuestion string, modelType string, personaID uint, knowledgeBaseIDs []uint) (*aihelper.AIHelper, string, code.Code) {
+	p, modelType, code_ := resolvePersona(userName, personaID, modelType)
+	if code_ != code.CodeSuccess {
+		return nil, "", code_
+	}
+
 	//1：创建一个新的会话
 	newSession := &model.Session{
-		ID:       uuid.New().String(),
-		UserName: userName,
-		Title:    userQuestion, // 可以根据需求设置标题，这边暂时用用户第一次的问题作为标题
+		ID:        uuid.New().String(),
+		UserName:  userName,
+		Title:     truncateTitle(userQuestion), // 可以根据需求设置标题，这边暂时用用户第一次的问题作为标题
+		ModelType: modelType,
+		PersonaID: personaID,
 	}
 	createdSession, err := session.CreateSession(newSession) //在数据库中存放该次会话（建表）
 	if err != nil {
-		log.Println("CreateSessionAndSendMessage CreateSession error:", err)
-		return "", "", code.CodeServerBusy
+		log.Println("createSessionWithHelper CreateSession error:", err)
+		return nil, "", code.CodeServerBusy
 	}
 
 	//2：获取AIHelper并通过其管理消息
 	manager := aihelper.GetGlobalManager()
-	config := map[string]interface{}{
-		"apiKey": "your-api-key", // TODO: 从配置中获取
-	}
-	helper, err := manager.GetOrCreateAIHelper(userName, createdSession.ID, modelType, config)
+	helper, err := manager.GetOrCreateAIHelper(userName, createdSession.ID, modelType, nil)
 	//一个会话 = 一个AIHelper = 一段上下文
 	if err != nil {
-		log.Println("CreateSessionAndSendMessage GetOrCreateAIHelper error:", err)
-		return "", "", code.AIModelFail
+		log.Println("createSessionWithHelper GetOrCreateAIHelper error:", err)
+		return nil, "", code.AIModelFail
+	}
+	if p != nil {
+		helper.SetPersona(p.ID, p.SystemPrompt, p.Temperature)
+	}
+	if len(knowledgeBaseIDs) > 0 {
+		if code_ := knowledge.AttachKnowledgeBases(userName, helper, knowledgeBaseIDs); code_ != code.CodeSuccess {
+			return nil, "", code_
+		}
+	}
+	return helper, createdSession.ID, code.CodeSuccess
+}
+
+// 登记一次生成，ctx取消（客户端断开）或调用停止接口时生成都会停止
+func startGeneration(ctx context.Context, userName string, sessionID string) *aihelper.Generation {
+	return aihelper.GetGlobalGenerationRegistry().Start(ctx, userName, sessionID)
+}
+
+func CreateSessionAndSendMessage(ctx context.Context, userName string, userQuestion string, modelType string, personaID uint, knowledgeBaseIDs []uint, attachmentIDs []string) (string, string, []model.Source, code.Code) {
+	//先校验图片，避免创建出空会话
+	attachments, code_ := attachment.ResolveAttachments(userName, attachmentIDs)
+	if code_ != code.CodeSuccess {
+		return "", "", nil, code_
+	}
+	helper, sessionID, code_ := createSessionWithHelper(userName, userQuestion, modelType, personaID, knowledgeBaseIDs)
+	if code_ != code.CodeSuccess {
+		return "", "", nil, code_
 	}
 
 	//3：生成AI回复
-	aiResponse, err_ := helper.GenerateResponse(userName, ctx, userQuestion)
+	gen := startGeneration(ctx, userName, sessionID)
+	defer aihelper.GetGlobalGenerationRegistry().Finish(gen)
+	aiResponse, err_ := helper.GenerateResponse(userName, gen.Ctx, userQuestion, attachments...)
 	if err_ != nil {
 		log.Println("CreateSessionAndSendMessage GenerateResponse error:", err_)
-		return "", "", code.AIModelFail
+		return "", "", nil, code.AIModelFail
 	}
+	helper.GenerateTitle() //后台生成会话标题
 
-	return createdSession.ID, aiResponse.Content, code.CodeSuccess
+	return sessionID, aiResponse.Content, decodeSources(aiResponse.Sources), code.CodeSuccess
 }
 
-func CreateStreamSessionOnly(userName string, userQuestion string) (string, code.Code) {
-	newSession := &model.Session{
-		ID:       uuid.New().String(),
-		UserName: userName,
-		Title:    userQuestion,
+func CreateStreamSessionOnly(userName string, userQuestion string, modelType string, personaID uint, knowledgeBaseIDs []uint, attachmentIDs []string) (string, code.Code) {
+	if _, code_ := attachment.ResolveAttachments(userName, attachmentIDs); code_ != code.CodeSuccess {
+		return "", code_
 	}
-	createdSession, err := session.CreateSession(newSession)
-	if err != nil {
-		log.Println("CreateStreamSessionOnly CreateSession error:", err)
-		return "", code.CodeServerBusy
+	_, sessionID, code_ := createSessionWithHelper(userName, userQuestion, modelType, personaID, knowledgeBaseIDs)
+	if code_ != code.CodeSuccess {
+		return "", code_
 	}
-	return createdSession.ID, code.CodeSuccess
+	return sessionID, code.CodeSuccess
 } //SSE场景，前端先拿到sessionID，再单独发流式请求
 
-func StreamMessageToExistingSession(userName string, sessionID string, userQuestion string, modelType string, writer http.ResponseWriter) code.Code {
-	// 确保 writer 支持 Flush
-	flusher, ok := writer.(http.Flusher) //流式输出必须Flush(),否则数据不会实时推送
-	if !ok {
-		log.Println("StreamMessageToExistingSession: streaming unsupported")
-		return code.CodeServerBusy
+// 在会话上执行一次生成，cb为nil时同步生成
+type generateFunc func(helper *aihelper.AIHelper, ctx context.Context, cb aihelper.ReplyCallback) (*model.Message, error)
+
+// 生成失败时对应的状态码
+func generateErrorCode(err error) code.Code {
+	if errors.Is(err, aihelper.ErrMessageNotFound) {
+		return code.CodeRecordNotFound
+	}
+	return code.AIModelFail
+}
+
+// 解析回答引用的知识库资料
+func decodeSources(raw string) []model.Source {
+	if raw == "" {
+		return nil
+	}
+	var sources []model.Source
+	if err := json.Unmarshal([]byte(raw), &sources); err != nil {
+		log.Println("decodeSources error:", err)
+		return nil
+	}
+	return sources
+}
+
+// 获取会话锁，同一会话的对话轮次和修改串行执行；释放时通知其他实例会话已变化，释放函数可以重复调用
+func lockSession(ctx context.Context, userName string, sessionID string) (func(), code.Code) {
+	unlock, err := aihelper.LockSession(ctx, sessionID)
+	if err != nil {
+		log.Println("lockSession error:", err)
+		if errors.Is(err, aihelper.ErrSessionBusy) {
+			return nil, code.CodeSessionBusy
+		}
+		return nil, code.CodeServerBusy
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			aihelper.GetGlobalManager().Invalidate(userName, sessionID)
+			unlock()
+		})
+	}, code.CodeSuccess
+}
+
+// 同步执行一次生成，返回AI回答及其引用的资料
+func generateReply(ctx context.Context, userName string, sessionID string, modelType string, run generateFunc) (string, []model.Source, code.Code) {
+	//0：获取会话锁，保证拿到的是最新的会话
+	unlock, code_ := lockSession(ctx, userName, sessionID)
+	if code_ != code.CodeSuccess {
+		return "", nil, code_
 	}
+	defer unlock()
 
+	//1：获取AIHelper
 	manager := aihelper.GetGlobalManager()
-	config := map[string]interface{}{
-		"apiKey": "your-api-key", // TODO: 从配置中获取
+	helper, err := manager.GetOrCreateAIHelper(userName, sessionID, modelType, nil)
+	if err != nil {
+		log.Println("generateReply GetOrCreateAIHelper error:", err)
+		if errors.Is(err, aihelper.ErrSessionNotFound) {
+			return "", nil, code.CodeRecordNotFound
+		}
+		return "", nil, code.AIModelFail
+	}
+
+	//2：生成AI回复
+	gen := startGeneration(ctx, userName, sessionID)
+	defer aihelper.GetGlobalGenerationRegistry().Finish(gen)
+	aiResponse, err_ := run(helper, gen.Ctx, nil)
+	if err_ != nil {
+		log.Println("generateReply error:", err_)
+		return "", nil, generateErrorCode(err_)
 	}
-	helper, err := manager.GetOrCreateAIHelper(userName, sessionID, modelType, config)
+	helper.GenerateTitle() //会话还没有标题时在后台生成
+
+	return aiResponse.Content, decodeSources(aiResponse.Sources), code.CodeSuccess
+}
+
+// 流式执行一次生成，通过SSE事件把内容推送给前端；返回错误码时由调用方发送error事件，调用方结束时需关闭stream
+func streamReply(ctx context.Context, userName string, sessionID string, modelType string, stream *sse.Writer, run generateFunc) code.Code {
+	unlock, code_ := lockSession(ctx, userName, sessionID)
+	if code_ != code.CodeSuccess {
+		return code_
+	}
+	defer unlock()
+
+	manager := aihelper.GetGlobalManager()
+	helper, err := manager.GetOrCreateAIHelper(userName, sessionID, modelType, nil)
 	if err != nil {
-		log.Println("StreamMessageToExistingSession GetOrCreateAIHelper error:", err)
+		log.Println("streamReply GetOrCreateAIHelper error:", err)
+		if errors.Is(err, aihelper.ErrSessionNotFound) {
+			return code.CodeRecordNotFound
+		}
 		return code.AIModelFail
 	}
 
-	//定义StreamCallback
-	cb := func(msg string) {
-		// 直接发送数据，不转义
-		// SSE 格式：data: <content>\n\n
-		log.Printf("[SSE] Sending chunk: %s (len=%d)\n", msg, len(msg))
-		_, err := writer.Write([]byte("data: " + msg + "\n\n"))
-		if err != nil {
+	//登记本次生成，并把会话id和生成id下发给前端，前端停止生成或断线续传时带上生成id
+	gen := startStreamGeneration(ctx, userName, sessionID, stream)
+	defer aihelper.GetGlobalGenerationRegistry().Finish(gen)
+	if err := stream.Send(sse.EventSession, "", sse.SessionData{SessionID: sessionID, GenerationID: gen.ID}); err != nil {
+		log.Println("streamReply write session error:", err)
+		return code.CodeServerBusy
+	}
+
+	cb := func(messageID string, msg string) {
+		if err := stream.Send(sse.EventDelta, messageID, sse.DeltaData{Text: msg}); err != nil {
 			log.Println("[SSE] Write error:", err)
-			return
 		}
-		flusher.Flush() //  每次必须 flush
-		log.Println("[SSE] Flushed")
 	}
 
-	_, err_ := helper.StreamResponse(userName, ctx, cb, userQuestion)
+	reply, err_ := run(helper, gen.Ctx, cb)
 	//调用流式生成
 	if err_ != nil {
-		log.Println("StreamMessageToExistingSession StreamResponse error:", err_)
-		return code.AIModelFail
+		log.Println("streamReply error:", err_)
+		return generateErrorCode(err_)
+	}
+	if reply.Truncated {
+		log.Printf("streamReply: generation %s stopped\n", gen.ID)
 	}
 
-	_, err = writer.Write([]byte("data: [DONE]\n\n"))
-	//发送结束标记
-	if err != nil {
-		log.Println("StreamMessageToExistingSession write DONE error:", err)
-		return code.AIModelFail
+	//结束前下发用量，done事件带上本次回答引用的资料
+	usage := sse.UsageData{
+		ModelID:          reply.ModelID,
+		PromptTokens:     reply.PromptTokens,
+		CompletionTokens: reply.CompletionTokens,
+		TotalTokens:      reply.TotalTokens,
+		LatencyMs:        reply.LatencyMs,
+	}
+	if err := stream.Send(sse.EventUsage, reply.MessageID, usage); err != nil {
+		log.Println("streamReply write usage error:", err)
+	}
+	done := sse.DoneData{Truncated: reply.Truncated}
+	if reply.Sources != "" {
+		done.Sources = json.RawMessage(reply.Sources)
+	}
+	if err := stream.Done(reply.MessageID, done); err != nil {
+		log.Println("streamReply write done error:", err)
+		return code.CodeSuccess //生成已经完成并保存，客户端断开不算失败
+	}
+
+	//回答结束后，会话还没有标题时生成标题，并以单独的title事件下发（最多等待timeoutSeconds）
+	//回答已经保存，等待标题时不再占用会话，下一轮对话可以开始
+	unlock()
+	if titleCh := helper.GenerateTitle(); titleCh != nil {
+		writeTitleEvent(gen.Ctx, stream, reply.MessageID, sessionID, titleCh)
 	}
-	flusher.Flush()
 
 	return code.CodeSuccess
 }
 
-func CreateStreamSessionAndSendMessage(userName string, userQuestion string, modelType string, writer http.ResponseWriter) (string, code.Code) {
+// 等待标题生成并通过SSE的title事件下发，客户端断开或超时后不再等待（标题仍会在后台写入数据库）
+func writeTitleEvent(ctx context.Context, stream *sse.Writer, messageID string, sessionID string, titleCh <-chan string) {
+	timeout := time.Duration(config.GetConfig().TitleConfig.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case title, ok := <-titleCh:
+		if !ok {
+			return
+		}
+		if err := stream.Send(sse.EventTitle, messageID, sse.TitleData{SessionID: sessionID, Title: title}); err != nil {
+			log.Println("streamReply write title error:", err)
+		}
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
 
-	sessionID, code_ := CreateStreamSessionOnly(userName, userQuestion)
+func StreamMessageToExistingSession(ctx context.Context, userName string, sessionID string, userQuestion string, modelType string, attachmentIDs []string, stream *sse.Writer) code.Code {
+	attachments, code_ := attachment.ResolveAttachments(userName, attachmentIDs)
+	if code_ != code.CodeSuccess {
+		return code_
+	}
+	return streamReply(ctx, userName, sessionID, modelType, stream, func(helper *aihelper.AIHelper, ctx context.Context, cb aihelper.ReplyCallback) (*model.Message, error) {
+		return helper.StreamResponse(userName, ctx, cb, userQuestion, attachments...)
+	})
+}
+
+func CreateStreamSessionAndSendMessage(ctx context.Context, userName string, userQuestion string, modelType string, personaID uint, knowledgeBaseIDs []uint, attachmentIDs []string, stream *sse.Writer) (string, code.Code) {
+
+	sessionID, code_ := CreateStreamSessionOnly(userName, userQuestion, modelType, personaID, knowledgeBaseIDs, attachmentIDs)
 	if code_ != code.CodeSuccess {
 		return "", code_
 	}
 
-	code_ = StreamMessageToExistingSession(userName, sessionID, userQuestion, modelType, writer)
+	code_ = StreamMessageToExistingSession(ctx, userName, sessionID, userQuestion, modelType, attachmentIDs, stream)
 	if code_ != code.CodeSuccess {
 
 		return sessionID, code_
@@ -148,27 +591,41 @@ func CreateStreamSessionAndSendMessage(userName string, userQuestion string, mod
 	return sessionID, code.CodeSuccess
 } //拼接两个函数，一键完成：建会话+SSE输出
 
-func ChatSend(userName string, sessionID string, userQuestion string, modelType string) (string, code.Code) {
-	//1：获取AIHelper
-	manager := aihelper.GetGlobalManager()
-	config := map[string]interface{}{
-		"apiKey": "your-api-key", // TODO: 从配置中获取
-	}
-	helper, err := manager.GetOrCreateAIHelper(userName, sessionID, modelType, config)
-	if err != nil {
-		log.Println("ChatSend GetOrCreateAIHelper error:", err)
-		return "", code.AIModelFail
+func ChatSend(ctx context.Context, userName string, sessionID string, userQuestion string, modelType string, attachmentIDs []string) (string, []model.Source, code.Code) {
+	attachments, code_ := attachment.ResolveAttachments(userName, attachmentIDs)
+	if code_ != code.CodeSuccess {
+		return "", nil, code_
 	}
+	return generateReply(ctx, userName, sessionID, modelType, func(helper *aihelper.AIHelper, ctx context.Context, _ aihelper.ReplyCallback) (*model.Message, error) {
+		return helper.GenerateResponse(userName, ctx, userQuestion, attachments...)
+	})
+} //和CreateSessionAndSendMessage的区别是，不建会话
 
-	//2：生成AI回复
-	aiResponse, err_ := helper.GenerateResponse(userName, ctx, userQuestion)
-	if err_ != nil {
-		log.Println("ChatSend GenerateResponse error:", err_)
-		return "", code.AIModelFail
-	}
+// 重新生成最后一次回答
+func Regenerate(ctx context.Context, userName string, sessionID string, modelType string) (string, []model.Source, code.Code) {
+	return generateReply(ctx, userName, sessionID, modelType, func(helper *aihelper.AIHelper, ctx context.Context, cb aihelper.ReplyCallback) (*model.Message, error) {
+		return helper.Regenerate(userName, ctx, cb)
+	})
+}
 
-	return aiResponse.Content, code.CodeSuccess
-} //和CreateSessionAndSendMessage的区别是，不建会话
+func RegenerateStream(ctx context.Context, userName string, sessionID string, modelType string, stream *sse.Writer) code.Code {
+	return streamReply(ctx, userName, sessionID, modelType, stream, func(helper *aihelper.AIHelper, ctx context.Context, cb aihelper.ReplyCallback) (*model.Message, error) {
+		return helper.Regenerate(userName, ctx, cb)
+	})
+}
+
+// 修改之前的某个问题并重新回答，原来的对话作为另一个分支保留
+func EditMessage(ctx context.Context, userName string, sessionID string, messageID string, userQuestion string, modelType string) (string, []model.Source, code.Code) {
+	return generateReply(ctx, userName, sessionID, modelType, func(helper *aihelper.AIHelper, ctx context.Context, cb aihelper.ReplyCallback) (*model.Message, error) {
+		return helper.EditAndResend(userName, ctx, cb, messageID, userQuestion)
+	})
+}
+
+func EditMessageStream(ctx context.Context, userName string, sessionID string, messageID string, userQuestion string, modelType string, stream *sse.Writer) code.Code {
+	return streamReply(ctx, userName, sessionID, modelType, stream, func(helper *aihelper.AIHelper, ctx context.Context, cb aihelper.ReplyCallback) (*model.Message, error) {
+		return helper.EditAndResend(userName, ctx, cb, messageID, userQuestion)
+	})
+}
 
 // 获取一次会话中的所有信息
 func GetChatHistory(userName string, sessionID string) ([]model.History, code.Code) {
@@ -176,25 +633,77 @@ func GetChatHistory(userName string, sessionID string) ([]model.History, code.Co
 	manager := aihelper.GetGlobalManager()
 	helper, exists := manager.GetAIHelper(userName, sessionID)
 	if !exists {
-		return nil, code.CodeServerBusy
+		return nil, code.CodeRecordNotFound
 	}
 
+	return buildHistory(helper), code.CodeSuccess
+}
+
+// 把当前分支转换为历史格式，并附上每个位置的其他版本
+func buildHistory(helper *aihelper.AIHelper) []model.History {
 	messages := helper.GetMessages()
 	history := make([]model.History, 0, len(messages))
 
-	// 转换消息为历史格式（根据消息顺序或内容判断用户/AI消息）
+	// 一次回答可能包含多条消息（工具调用、工具结果、最终回答），分支挂在回答的第一条消息上
+	replyHead := ""
+	// 转换消息为历史格式（工具调用和工具结果属于中间过程，不展示给前端）
 	for i, msg := range messages {
-		isUser := i%2 == 0 //用户和AI肯定是一问一答
-		history = append(history, model.History{
-			IsUser:  isUser,
-			Content: msg.Content,
-		})
+		if i > 0 && messages[i-1].IsUser {
+			replyHead = msg.MessageID
+		}
+		if msg.ToolCalls != "" || msg.ToolCallID != "" {
+			continue
+		}
+		head := msg.MessageID
+		if !msg.IsUser && replyHead != "" {
+			head = replyHead
+		}
+		item := model.History{
+			MessageID:   head,
+			ParentID:    msg.ParentID,
+			IsUser:      msg.IsUser,
+			Content:     msg.Content,
+			Truncated:   msg.Truncated,
+			Sources:     decodeSources(msg.Sources),
+			Attachments: aihelper.DecodeAttachments(msg.Attachments),
+		}
+		if siblings, index := helper.GetSiblings(head); len(siblings) > 1 {
+			item.SiblingIDs = siblings
+			item.SiblingIndex = index
+		}
+		history = append(history, item)
 	}
+	return history
+}
+
+// 切换到某条消息所在的分支，返回切换后的历史
+func SwitchBranch(userName string, sessionID string, messageID string) ([]model.History, code.Code) {
+	unlock, code_ := lockSession(context.Background(), userName, sessionID)
+	if code_ != code.CodeSuccess {
+		return nil, code_
+	}
+	defer unlock()
 
-	return history, code.CodeSuccess
+	manager := aihelper.GetGlobalManager()
+	helper, exists := manager.GetAIHelper(userName, sessionID)
+	if !exists {
+		return nil, code.CodeRecordNotFound
+	}
+	if err := helper.SwitchBranch(messageID); err != nil {
+		return nil, code.CodeRecordNotFound
+	}
+	return buildHistory(helper), code.CodeSuccess
 }
 
-func ChatStreamSend(userName string, sessionID string, userQuestion string, modelType string, writer http.ResponseWriter) code.Code {
+func ChatStreamSend(ctx context.Context, userName string, sessionID string, userQuestion string, modelType string, attachmentIDs []string, stream *sse.Writer) code.Code {
 
-	return StreamMessageToExistingSession(userName, sessionID, userQuestion, modelType, writer)
+	return StreamMessageToExistingSession(ctx, userName, sessionID, userQuestion, modelType, attachmentIDs, stream)
 } //语义包装函数，用于对外暴露，和ChatSend类似，不创建会话
+
+// 停止生成：指定了生成id时只停止该次生成，否则停止会话上所有正在进行的生成
+func StopGeneration(userName string, generationID string, sessionID string) code.Code {
+	if !aihelper.StopGeneration(userName, generationID, sessionID) {
+		return code.CodeRecordNotFound
+	}
+	return code.CodeSuccess
+}
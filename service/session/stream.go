@@ -0,0 +1,99 @@
+package session
+
+import (
+	"GopherAI/common/aihelper"
+	"GopherAI/common/code"
+	"GopherAI/common/redis"
+	"GopherAI/common/sse"
+	"GopherAI/config"
+	"context"
+	"log"
+	"time"
+)
+
+// 续传时每次等待新事件的最长时间，超时后发送一次心跳
+const resumePollInterval = 15 * time.Second
+
+// redisBuffer 把一次生成的事件缓存在Redis中
+type redisBuffer struct {
+	generationID string
+	ttl          time.Duration
+}
+
+func (b *redisBuffer) Append(id int64, event string, payload []byte) error {
+	return redis.AppendStreamEvent(b.generationID, id, event, payload, b.ttl)
+}
+
+func (b *redisBuffer) Close() error {
+	return redis.CloseStreamBuffer(b.generationID, b.ttl)
+}
+
+func streamBufferTTL() time.Duration {
+	ttl := time.Duration(config.GetConfig().StreamBufferConfig.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	return ttl
+}
+
+// 登记一次流式生成：开启续传时事件缓存在Redis中，生成不随客户端断开而停止（只能通过停止接口取消）
+// Redis不可用时退回到普通的流式生成
+func startStreamGeneration(ctx context.Context, userName string, sessionID string, stream *sse.Writer) *aihelper.Generation {
+	if !config.GetConfig().StreamBufferConfig.Enabled {
+		return startGeneration(ctx, userName, sessionID)
+	}
+
+	gen := startGeneration(context.WithoutCancel(ctx), userName, sessionID)
+	ttl := streamBufferTTL()
+	if err := redis.StartStreamBuffer(gen.ID, userName, sessionID, ttl); err != nil {
+		log.Println("startStreamGeneration StartStreamBuffer error:", err)
+		aihelper.GetGlobalGenerationRegistry().Finish(gen)
+		return startGeneration(ctx, userName, sessionID)
+	}
+	stream.SetBuffer(&redisBuffer{generationID: gen.ID, ttl: ttl})
+	return gen
+}
+
+// ResumeStream 续传一次生成的输出：先回放序号lastEventID之后已缓存的事件，再跟随实时输出，直到生成结束
+func ResumeStream(ctx context.Context, userName string, generationID string, lastEventID int64, stream *sse.Writer) code.Code {
+	if !config.GetConfig().StreamBufferConfig.Enabled {
+		return code.CodeFeatureDisabled
+	}
+	owner, _, ok, err := redis.GetStreamOwner(generationID)
+	if err != nil {
+		log.Println("ResumeStream GetStreamOwner error:", err)
+		return code.CodeServerBusy
+	}
+	if !ok || owner != userName {
+		return code.CodeRecordNotFound
+	}
+
+	for {
+		events, ended, err := redis.ReadStreamEvents(ctx, generationID, lastEventID, resumePollInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return code.CodeSuccess //客户端再次断开
+			}
+			log.Println("ResumeStream ReadStreamEvents error:", err)
+			return code.CodeServerBusy
+		}
+		for _, e := range events {
+			if err := stream.Replay(e.ID, e.Event, []byte(e.Payload)); err != nil {
+				return code.CodeSuccess
+			}
+			lastEventID = e.ID
+		}
+		if ended {
+			return code.CodeSuccess
+		}
+		if len(events) == 0 {
+			// 生成所在的实例异常退出时不会写入结束标记，缓存过期后结束
+			if _, _, ok, err := redis.GetStreamOwner(generationID); err == nil && !ok {
+				return code.CodeRecordNotFound
+			}
+			if err := stream.Ping(); err != nil {
+				return code.CodeSuccess
+			}
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package transfer
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/dao/message"
+	"GopherAI/dao/session"
+	"GopherAI/model"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 批量导出时每次查询消息的会话数
+const exportBatchSessions = 50
+
+// ExportSession 导出一个会话，返回文件名和文件内容
+func ExportSession(userName string, sessionID string, format string) (string, []byte, code.Code) {
+	if !validFormat(format) {
+		return "", nil, code.CodeInvalidParams
+	}
+	sess, err := session.GetUserSessionByID(userName, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil, code.CodeRecordNotFound
+	}
+	if err != nil {
+		log.Println("ExportSession GetUserSessionByID error:", err)
+		return "", nil, code.CodeServerBusy
+	}
+	msgs, err := message.GetMessagesBySessionID(sessionID)
+	if err != nil {
+		log.Println("ExportSession GetMessagesBySessionID error:", err)
+		return "", nil, code.CodeServerBusy
+	}
+
+	data, err := render(sess, msgs, format)
+	if err != nil {
+		log.Println("ExportSession render error:", err)
+		return "", nil, code.CodeServerBusy
+	}
+	return fileName(sess, format), data, code.CodeSuccess
+}
+
+// ExportAllSessions 导出用户的所有会话，每个会话一个文件，打包成zip
+func ExportAllSessions(userName string, format string) ([]byte, code.Code) {
+	if !validFormat(format) {
+		return nil, code.CodeInvalidParams
+	}
+	sessions, err := session.GetAllSessionsByUserName(userName)
+	if err != nil {
+		log.Println("ExportAllSessions GetAllSessionsByUserName error:", err)
+		return nil, code.CodeServerBusy
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for start := 0; start < len(sessions); start += exportBatchSessions {
+		end := start + exportBatchSessions
+		if end > len(sessions) {
+			end = len(sessions)
+		}
+		batch := sessions[start:end]
+		ids := make([]string, 0, len(batch))
+		for _, s := range batch {
+			ids = append(ids, s.ID)
+		}
+		msgs, err := message.GetMessagesBySessionIDs(ids)
+		if err != nil {
+			log.Println("ExportAllSessions GetMessagesBySessionIDs error:", err)
+			return nil, code.CodeServerBusy
+		}
+		bySession := make(map[string][]model.Message, len(batch))
+		for _, m := range msgs {
+			bySession[m.SessionID] = append(bySession[m.SessionID], m)
+		}
+
+		for i := range batch {
+			data, err := render(&batch[i], bySession[batch[i].ID], format)
+			if err != nil {
+				log.Println("ExportAllSessions render error:", err)
+				return nil, code.CodeServerBusy
+			}
+			// 标题可能重复，文件名加上序号
+			w, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     fmt.Sprintf("%03d-%s", start+i+1, fileName(&batch[i], format)),
+				Method:   zip.Deflate,
+				Modified: batch[i].UpdatedAt,
+			})
+			if err == nil {
+				_, err = w.Write(data)
+			}
+			if err != nil {
+				log.Println("ExportAllSessions zip error:", err)
+				return nil, code.CodeServerBusy
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Println("ExportAllSessions zip error:", err)
+		return nil, code.CodeServerBusy
+	}
+	return buf.Bytes(), code.CodeSuccess
+}
+
+func validFormat(format string) bool {
+	return format == FormatMarkdown || format == FormatJSON || format == FormatOpenAI
+}
+
+func render(sess *model.Session, msgs []model.Message, format string) ([]byte, error) {
+	switch format {
+	case FormatMarkdown:
+		return renderMarkdown(sess, activePath(sess, msgs)), nil
+	case FormatOpenAI:
+		line, err := json.Marshal(toOpenAI(activePath(sess, msgs)))
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	default:
+		return json.MarshalIndent(toExportFile(sess, msgs), "", "  ")
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[\\/:*?"<>|\s]+`)
+
+// 用会话标题作为文件名
+func fileName(sess *model.Session, format string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(sess.Title, "_"), "_.")
+	if r := []rune(name); len(r) > 50 {
+		name = string(r[:50])
+	}
+	if name == "" {
+		name = sess.ID
+	}
+	ext := format
+	if format == FormatOpenAI {
+		ext = "jsonl"
+	}
+	return name + "." + ext
+}
+
+// 当前分支上的消息：从会话的ActiveLeafID沿父消息回溯到根，没有记录时取最后一条消息
+func activePath(sess *model.Session, msgs []model.Message) []*model.Message {
+	if len(msgs) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Message, len(msgs))
+	for i := range msgs {
+		byID[msgs[i].MessageID] = &msgs[i]
+	}
+	leaf, ok := byID[sess.ActiveLeafID]
+	if !ok {
+		leaf = &msgs[len(msgs)-1]
+	}
+
+	var path []*model.Message
+	for m := leaf; m != nil && len(path) < len(msgs); m = byID[m.ParentID] {
+		path = append(path, m)
+		if m.ParentID == "" {
+			break
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// 完整导出：会话信息和整棵消息树，可以原样导入
+func toExportFile(sess *model.Session, msgs []model.Message) *exportFile {
+	f := &exportFile{
+		Version: exportVersion,
+		Session: exportSession{
+			ID:           sess.ID,
+			Title:        sess.Title,
+			ModelType:    sess.ModelType,
+			ActiveLeafID: sess.ActiveLeafID,
+			CreatedAt:    sess.CreatedAt,
+			UpdatedAt:    sess.UpdatedAt,
+		},
+		Messages: make([]exportMessage, 0, len(msgs)),
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		f.Messages = append(f.Messages, exportMessage{
+			MessageID:   m.MessageID,
+			ParentID:    m.ParentID,
+			Role:        roleOf(m),
+			Content:     m.Content,
+			ToolCalls:   rawJSON(m.ToolCalls),
+			ToolCallID:  m.ToolCallID,
+			ToolName:    m.ToolName,
+			ModelID:     m.ModelID,
+			Truncated:   m.Truncated,
+			Sources:     rawJSON(m.Sources),
+			Attachments: decodeAttachments(m.Attachments),
+			CreatedAt:   m.CreatedAt,
+		})
+	}
+	return f
+}
+
+// OpenAI chat格式：只导出当前分支，工具调用按OpenAI的tool_calls/tool消息表示
+func toOpenAI(path []*model.Message) *openAIConversation {
+	conv := &openAIConversation{Messages: make([]openAIMessage, 0, len(path))}
+	for _, m := range path {
+		content, _ := json.Marshal(m.Content + attachmentPlaceholder(decodeAttachments(m.Attachments)))
+		msg := openAIMessage{
+			Role:       roleOf(m),
+			Content:    content,
+			ToolCalls:  rawJSON(m.ToolCalls),
+			ToolCallID: m.ToolCallID,
+		}
+		if msg.Role == roleTool {
+			msg.Name = m.ToolName
+		}
+		conv.Messages = append(conv.Messages, msg)
+	}
+	return conv
+}
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Markdown格式：只导出当前分支，方便阅读，工具调用的中间消息不展示
+func renderMarkdown(sess *model.Session, path []*model.Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", sess.Title)
+	if sess.ModelType != "" {
+		fmt.Fprintf(&b, "- 模型：%s\n", sess.ModelType)
+	}
+	fmt.Fprintf(&b, "- 创建时间：%s\n", sess.CreatedAt.Format(timeLayout))
+	fmt.Fprintf(&b, "- 导出时间：%s\n", time.Now().Format(timeLayout))
+
+	for _, m := range path {
+		if isToolMessage(m) {
+			continue
+		}
+		b.WriteString("\n---\n\n")
+		speaker := "用户"
+		if !m.IsUser {
+			speaker = "AI"
+			if m.ModelID != "" {
+				speaker += "（" + m.ModelID + "）"
+			}
+		}
+		fmt.Fprintf(&b, "**%s** · %s\n\n", speaker, m.CreatedAt.Format(timeLayout))
+		b.WriteString(strings.TrimSpace(m.Content))
+		b.WriteString("\n")
+		for _, att := range decodeAttachments(m.Attachments) {
+			fmt.Fprintf(&b, "\n> 图片：%s\n", att.FileName)
+		}
+		if m.Truncated {
+			b.WriteString("\n*（回答被中途停止）*\n")
+		}
+
+		var sources []model.Source
+		if m.Sources != "" && json.Unmarshal([]byte(m.Sources), &sources) == nil && len(sources) > 0 {
+			b.WriteString("\n参考资料：\n\n")
+			for _, s := range sources {
+				fmt.Fprintf(&b, "- [%d] %s\n", s.Index, s.FileName)
+			}
+		}
+	}
+	return []byte(b.String())
+}
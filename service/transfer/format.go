@@ -0,0 +1,117 @@
+package transfer //会话的导出与导入
+
+import (
+	"GopherAI/model"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 导出格式
+// 只有json格式带上图片信息（id、文件名、类型、识别结果），导入到上传图片的账号时可以继续使用原图；
+// md和openai-jsonl不包含图片内容，只在消息中以“[图片：文件名]”占位
+const (
+	FormatMarkdown = "md"
+	FormatJSON     = "json"
+	FormatOpenAI   = "openai-jsonl" //OpenAI微调数据的chat格式，每行一段对话
+)
+
+// 本项目的JSON导出格式版本
+const exportVersion = 1
+
+// 消息角色
+const (
+	roleUser      = "user"
+	roleAssistant = "assistant"
+	roleTool      = "tool"
+	roleSystem    = "system"
+)
+
+// exportFile 一个会话的完整导出（JSON格式），包含整棵消息树
+type exportFile struct {
+	Version  int             `json:"version"`
+	Session  exportSession   `json:"session"`
+	Messages []exportMessage `json:"messages"`
+}
+
+type exportSession struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	ModelType    string    `json:"model_type,omitempty"`
+	ActiveLeafID string    `json:"active_leaf_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type exportMessage struct {
+	MessageID  string          `json:"message_id"`
+	ParentID   string          `json:"parent_id,omitempty"`
+	Role       string          `json:"role"`
+	Content    string          `json:"content"`
+	ToolCalls  json.RawMessage `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+	ToolName   string          `json:"tool_name,omitempty"`
+	ModelID    string          `json:"model_id,omitempty"`
+	Truncated  bool            `json:"truncated,omitempty"`
+	Sources    json.RawMessage `json:"sources,omitempty"`
+	//用户消息附带的图片（只有元数据，不含图片内容）
+	Attachments []model.Attachment `json:"attachments,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// openAIConversation OpenAI chat格式的一段对话
+type openAIConversation struct {
+	Messages []openAIMessage `json:"messages"`
+}
+
+type openAIMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"` //导出时为字符串，导入时也接受多段内容的数组
+	ToolCalls  json.RawMessage `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+	Name       string          `json:"name,omitempty"`
+}
+
+// 消息的角色
+func roleOf(m *model.Message) string {
+	switch {
+	case m.IsUser:
+		return roleUser
+	case m.ToolCallID != "":
+		return roleTool
+	default:
+		return roleAssistant
+	}
+}
+
+// 工具调用过程中的消息（发起调用、工具结果），Markdown导出时不展示
+func isToolMessage(m *model.Message) bool {
+	return m.ToolCalls != "" || m.ToolCallID != ""
+}
+
+// 消息上的图片列表，解析失败时忽略
+func decodeAttachments(raw string) []model.Attachment {
+	var atts []model.Attachment
+	if raw == "" || json.Unmarshal([]byte(raw), &atts) != nil {
+		return nil
+	}
+	return atts
+}
+
+// md和openai-jsonl导出时图片的占位文字
+func attachmentPlaceholder(atts []model.Attachment) string {
+	var b strings.Builder
+	for _, att := range atts {
+		fmt.Fprintf(&b, "\n[图片：%s]", att.FileName)
+	}
+	return b.String()
+}
+
+// 字符串里的JSON原样嵌入，为空时省略
+func rawJSON(s string) json.RawMessage {
+	if s == "" || !json.Valid([]byte(s)) {
+		return nil
+	}
+	return json.RawMessage(s)
+}
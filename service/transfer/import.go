@@ -0,0 +1,346 @@
+package transfer
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/config"
+	"GopherAI/dao/attachment"
+	"GopherAI/dao/session"
+	"GopherAI/model"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 导入的限制
+const (
+	MaxImportSize      = 20 << 20 //导入文件最大20MB
+	maxImportSessions  = 200      //一次最多导入的会话数
+	maxImportMessages  = 5000     //一个会话最多的消息数
+	maxImportTitleRune = 100      //和会话标题的列宽一致
+)
+
+var errInvalidImport = errors.New("invalid import file")
+
+// ImportSessions 导入会话：支持本项目导出的JSON（单个会话或数组）、以及每行一个会话的JSONL（本项目格式或OpenAI chat格式）
+// 会话和消息使用新的ID，保留原有的时间；导入的会话在首次访问时按正常流程从数据库加载
+func ImportSessions(userName string, data []byte) ([]model.SessionInfo, code.Code) {
+	if len(data) > MaxImportSize {
+		return nil, code.CodeFileTooLarge
+	}
+	files, err := parseImport(data)
+	if err != nil || len(files) == 0 || len(files) > maxImportSessions {
+		return nil, code.CodeUnsupportedFile
+	}
+
+	// 先全部校验和转换，有一个会话不合法就整体拒绝
+	type pending struct {
+		sess *model.Session
+		msgs []model.Message
+	}
+	now := time.Now()
+	all := make([]pending, 0, len(files))
+	for _, f := range files {
+		sess, msgs, err := buildSession(userName, f, now)
+		if err != nil {
+			return nil, code.CodeUnsupportedFile
+		}
+		all = append(all, pending{sess: sess, msgs: msgs})
+	}
+
+	infos := make([]model.SessionInfo, 0, len(all))
+	for _, p := range all {
+		if err := ownAttachments(userName, p.msgs); err != nil {
+			log.Println("ImportSessions ownAttachments error:", err)
+			return nil, code.CodeServerBusy
+		}
+		if err := session.CreateSessionWithMessages(p.sess, p.msgs); err != nil {
+			log.Println("ImportSessions CreateSessionWithMessages error:", err)
+			return nil, code.CodeServerBusy
+		}
+		infos = append(infos, model.SessionInfo{
+			SessionID: p.sess.ID,
+			Title:     p.sess.Title,
+			ModelType: p.sess.ModelType,
+			CreatedAt: p.sess.CreatedAt,
+			UpdatedAt: p.sess.UpdatedAt,
+		})
+	}
+	return infos, code.CodeSuccess
+}
+
+// 解析导入文件：整体是一个JSON（对象或数组），或者每行一个JSON对象
+func parseImport(data []byte) ([]*exportFile, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil, errInvalidImport
+	}
+
+	var items []json.RawMessage
+	switch {
+	case data[0] == '[':
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+	case json.Valid(data):
+		items = []json.RawMessage{data}
+	default:
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				items = append(items, line)
+			}
+		}
+	}
+
+	files := make([]*exportFile, 0, len(items))
+	for _, item := range items {
+		f, err := parseItem(item)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// 带session字段的是本项目格式，否则按OpenAI chat格式解析
+func parseItem(item json.RawMessage) (*exportFile, error) {
+	var probe struct {
+		Session json.RawMessage `json:"session"`
+	}
+	if err := json.Unmarshal(item, &probe); err != nil {
+		return nil, err
+	}
+	if len(probe.Session) > 0 {
+		f := new(exportFile)
+		if err := json.Unmarshal(item, f); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	conv := new(openAIConversation)
+	if err := json.Unmarshal(item, conv); err != nil {
+		return nil, err
+	}
+	return fromOpenAI(conv)
+}
+
+// OpenAI格式没有消息树和时间，按顺序串成一条分支；system消息在本项目中由人设表示，导入时忽略
+func fromOpenAI(conv *openAIConversation) (*exportFile, error) {
+	f := new(exportFile)
+	parentID := ""
+	for _, m := range conv.Messages {
+		if m.Role == roleSystem {
+			continue
+		}
+		content, err := openAIContent(m.Content)
+		if err != nil {
+			return nil, err
+		}
+		id := uuid.New().String()
+		f.Messages = append(f.Messages, exportMessage{
+			MessageID:  id,
+			ParentID:   parentID,
+			Role:       m.Role,
+			Content:    content,
+			ToolCalls:  m.ToolCalls,
+			ToolCallID: m.ToolCallID,
+			ToolName:   m.Name,
+		})
+		parentID = id
+	}
+	return f, nil
+}
+
+// content可以是字符串、null，或者多段内容的数组（只取文本）
+func openAIContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// 转换成数据库记录：重新生成会话和消息ID并映射父消息，没有时间的消息从now开始依次递增
+func buildSession(userName string, f *exportFile, now time.Time) (*model.Session, []model.Message, error) {
+	if len(f.Messages) == 0 || len(f.Messages) > maxImportMessages {
+		return nil, nil, errInvalidImport
+	}
+
+	sessionID := uuid.New().String()
+	idMap := make(map[string]string, len(f.Messages))
+	for _, m := range f.Messages {
+		if m.MessageID != "" {
+			idMap[m.MessageID] = uuid.New().String()
+		}
+	}
+
+	msgs := make([]model.Message, 0, len(f.Messages))
+	for i, m := range f.Messages {
+		if m.Role != roleUser && m.Role != roleAssistant && m.Role != roleTool {
+			return nil, nil, errInvalidImport
+		}
+		newID, ok := idMap[m.MessageID]
+		if !ok {
+			newID = uuid.New().String()
+		}
+		// 父消息为空是根消息；指向文件中不存在的消息时接到上一条消息后面
+		parentID := ""
+		if m.ParentID != "" {
+			if parentID, ok = idMap[m.ParentID]; !ok && i > 0 {
+				parentID = msgs[i-1].MessageID
+			}
+		}
+		createdAt := m.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now.Add(time.Duration(i) * time.Millisecond)
+		}
+
+		msg := model.Message{
+			MessageID:  newID,
+			ParentID:   parentID,
+			SessionID:  sessionID,
+			UserName:   userName,
+			Content:    m.Content,
+			IsUser:     m.Role == roleUser,
+			ToolCallID: m.ToolCallID,
+			ToolName:   m.ToolName,
+			Truncated:  m.Truncated,
+			CreatedAt:  createdAt,
+		}
+		if m.Role == roleAssistant {
+			msg.ModelID = m.ModelID
+			if len(m.ToolCalls) > 0 && string(m.ToolCalls) != "null" {
+				msg.ToolCalls = string(m.ToolCalls)
+			}
+			if len(m.Sources) > 0 && string(m.Sources) != "null" {
+				msg.Sources = string(m.Sources)
+			}
+		}
+		if m.Role == roleUser && len(m.Attachments) > 0 {
+			data, err := json.Marshal(m.Attachments)
+			if err != nil {
+				return nil, nil, err
+			}
+			msg.Attachments = string(data)
+		}
+		if m.Role == roleTool && msg.ToolCallID == "" {
+			return nil, nil, errInvalidImport
+		}
+		msgs = append(msgs, msg)
+	}
+
+	activeLeafID, ok := idMap[f.Session.ActiveLeafID]
+	if !ok {
+		activeLeafID = msgs[len(msgs)-1].MessageID
+	}
+
+	// 模型不在当前配置中时使用默认模型
+	modelType := f.Session.ModelType
+	if _, ok := config.GetConfig().GetModelConfig(modelType); !ok {
+		modelType = config.GetConfig().DefaultModelType()
+	}
+
+	sess := &model.Session{
+		ID:             sessionID,
+		UserName:       userName,
+		Title:          importTitle(f.Session.Title, msgs),
+		TitleGenerated: strings.TrimSpace(f.Session.Title) != "",
+		ModelType:      modelType,
+		ActiveLeafID:   activeLeafID,
+		CreatedAt:      f.Session.CreatedAt,
+		UpdatedAt:      f.Session.UpdatedAt,
+	}
+	if sess.CreatedAt.IsZero() {
+		sess.CreatedAt = msgs[0].CreatedAt
+	}
+	if sess.UpdatedAt.IsZero() {
+		sess.UpdatedAt = msgs[len(msgs)-1].CreatedAt
+	}
+	return sess, msgs, nil
+}
+
+// 导入的图片只保留当前用户自己上传过的（使用数据库中的元数据）；其他图片去掉id，只保留文件名等信息，
+// 模型看到的是文件名提示，也避免借导入文件读取其他用户的图片
+func ownAttachments(userName string, msgs []model.Message) error {
+	var ids []string
+	for i := range msgs {
+		for _, att := range decodeAttachments(msgs[i].Attachments) {
+			if att.ID != "" {
+				ids = append(ids, att.ID)
+			}
+		}
+	}
+	owned := make(map[string]model.Attachment)
+	if len(ids) > 0 {
+		atts, err := attachment.GetAttachmentsByIDs(userName, ids)
+		if err != nil {
+			return err
+		}
+		for _, att := range atts {
+			owned[att.ID] = att
+		}
+	}
+
+	for i := range msgs {
+		atts := decodeAttachments(msgs[i].Attachments)
+		if len(atts) == 0 {
+			msgs[i].Attachments = ""
+			continue
+		}
+		for j, att := range atts {
+			if own, ok := owned[att.ID]; ok {
+				atts[j] = own
+			} else {
+				atts[j] = model.Attachment{FileName: att.FileName, MIMEType: att.MIMEType, Label: att.Label}
+			}
+		}
+		data, err := json.Marshal(atts)
+		if err != nil {
+			return err
+		}
+		msgs[i].Attachments = string(data)
+	}
+	return nil
+}
+
+// 没有标题时和新建会话一样用第一个问题作为标题
+func importTitle(title string, msgs []model.Message) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		for _, m := range msgs {
+			if m.IsUser {
+				title = strings.TrimSpace(m.Content)
+				break
+			}
+		}
+	}
+	if title == "" {
+		title = "导入的会话"
+	}
+	if r := []rune(title); len(r) > maxImportTitleRune {
+		title = string(r[:maxImportTitleRune])
+	}
+	return title
+}
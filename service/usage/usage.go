@@ -0,0 +1,95 @@
+package usage //token用量与费用统计
+
+import (
+	"GopherAI/common/code"
+	"GopherAI/config"
+	"GopherAI/dao/message"
+	"GopherAI/model"
+	"log"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// 解析查询的时间段[from, to]（按天，包含to当天），默认最近30天
+func parseRange(from string, to string) (time.Time, time.Time, bool) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+	start := end.AddDate(0, 0, -30)
+
+	if to != "" {
+		t, err := time.ParseInLocation(dateLayout, to, time.Local)
+		if err != nil {
+			return start, end, false
+		}
+		end = t.AddDate(0, 0, 1)
+	}
+	if from != "" {
+		t, err := time.ParseInLocation(dateLayout, from, time.Local)
+		if err != nil {
+			return start, end, false
+		}
+		start = t
+	}
+	return start, end, start.Before(end)
+}
+
+// 按价格表估算费用
+func fillCost(stats []model.UsageStat) {
+	pricing := config.GetConfig().Pricing
+	for i := range stats {
+		price, ok := pricing[stats[i].ModelID]
+		if !ok {
+			continue
+		}
+		stats[i].Cost = float64(stats[i].PromptTokens)/1000*price.PromptPer1K +
+			float64(stats[i].CompletionTokens)/1000*price.CompletionPer1K
+	}
+}
+
+// 汇总总费用
+func totalCost(stats []model.UsageStat) float64 {
+	total := 0.0
+	for _, s := range stats {
+		total += s.Cost
+	}
+	return total
+}
+
+func GetDailyUsage(userName string, from string, to string) ([]model.UsageStat, float64, code.Code) {
+	start, end, ok := parseRange(from, to)
+	if !ok {
+		return nil, 0, code.CodeInvalidParams
+	}
+	stats, err := message.GetUsageByDay(userName, start, end)
+	if err != nil {
+		log.Println("GetDailyUsage error:", err)
+		return nil, 0, code.CodeServerBusy
+	}
+	fillCost(stats)
+	return stats, totalCost(stats), code.CodeSuccess
+}
+
+func GetModelUsage(userName string, from string, to string) ([]model.UsageStat, float64, code.Code) {
+	start, end, ok := parseRange(from, to)
+	if !ok {
+		return nil, 0, code.CodeInvalidParams
+	}
+	stats, err := message.GetUsageByModel(userName, start, end)
+	if err != nil {
+		log.Println("GetModelUsage error:", err)
+		return nil, 0, code.CodeServerBusy
+	}
+	fillCost(stats)
+	return stats, totalCost(stats), code.CodeSuccess
+}
+
+func GetSessionUsage(userName string, sessionID string) ([]model.UsageStat, float64, code.Code) {
+	stats, err := message.GetUsageBySession(userName, sessionID)
+	if err != nil {
+		log.Println("GetSessionUsage error:", err)
+		return nil, 0, code.CodeServerBusy
+	}
+	fillCost(stats)
+	return stats, totalCost(stats), code.CodeSuccess
+}
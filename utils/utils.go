@@ -2,10 +2,11 @@ package utils
 
 import (
 	"GopherAI/model"
-	"crypto/md5"   //提供MD5哈希算法的实现
-	"encoding/hex" //用于将二进制数据编码成十六进制字符串
-	"math/rand"    //提供伪随机数生成器
-	"strconv"      //用于字符串与基础类型之间的转换
+	"crypto/md5"    //提供MD5哈希算法的实现
+	"encoding/hex"  //用于将二进制数据编码成十六进制字符串
+	"encoding/json" //用于序列化工具调用列表
+	"math/rand"     //提供伪随机数生成器
+	"strconv"       //用于字符串与基础类型之间的转换
 	"time"
 
 	"github.com/cloudwego/eino/schema" //AI对话中的“消息抽象结构”
@@ -47,11 +48,25 @@ func GenerateUUID() string {
 
 // 将 schema 消息转换为数据库可存储的格式
 func ConvertToModelMessage(sessionID string, userName string, msg *schema.Message) *model.Message {
-	return &model.Message{
-		SessionID: sessionID,   //会话ID，用于关联一轮对话
-		UserName:  userName,    //用户名，用于区分不同用户
-		Content:   msg.Content, //消息内容
+	modelMsg := &model.Message{
+		SessionID:  sessionID,   //会话ID，用于关联一轮对话
+		UserName:   userName,    //用户名，用于区分不同用户
+		Content:    msg.Content, //消息内容
+		IsUser:     msg.Role == schema.User,
+		ToolCallID: msg.ToolCallID, //工具结果消息才有
+		ToolName:   msg.ToolName,
 	}
+	if len(msg.ToolCalls) > 0 {
+		data, _ := json.Marshal(msg.ToolCalls) //工具调用列表序列化后存储
+		modelMsg.ToolCalls = string(data)
+	}
+	if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		//保留模型返回的token用量，用于计费统计
+		modelMsg.PromptTokens = msg.ResponseMeta.Usage.PromptTokens
+		modelMsg.CompletionTokens = msg.ResponseMeta.Usage.CompletionTokens
+		modelMsg.TotalTokens = msg.ResponseMeta.Usage.TotalTokens
+	}
+	return modelMsg
 }
 
 // 将数据库消息转换为 schema 消息（供 AI 使用，只关心谁在说话，说了什么）
@@ -61,11 +76,19 @@ func ConvertToSchemaMessages(msgs []*model.Message) []*schema.Message {
 		role := schema.Assistant //默认角色，AI
 		if m.IsUser {
 			role = schema.User //用户角色
+		} else if m.ToolCallID != "" {
+			role = schema.Tool //工具执行结果
+		}
+		schemaMsg := &schema.Message{
+			Role:       role, //用于判断内容为用户输入，还是AI输出
+			Content:    m.Content,
+			ToolCallID: m.ToolCallID,
+			ToolName:   m.ToolName,
+		}
+		if m.ToolCalls != "" {
+			_ = json.Unmarshal([]byte(m.ToolCalls), &schemaMsg.ToolCalls)
 		}
-		schemaMsgs = append(schemaMsgs, &schema.Message{
-			Role:    role, //用于判断内容为用户输入，还是AI输出
-			Content: m.Content,
-		})
+		schemaMsgs = append(schemaMsgs, schemaMsg)
 	}
 	return schemaMsgs
 }
@@ -4,6 +4,7 @@ import Register from '../views/Register.vue'
 import Menu from '../views/Menu.vue'
 import AIChat from '../views/AIChat.vue'
 import ImageRecognition from '../views/ImageRecognition.vue'
+import KnowledgeBase from '../views/KnowledgeBase.vue'
 
 const routes = [
   {
@@ -37,6 +38,12 @@ const routes = [
     name: 'ImageRecognition',
     component: ImageRecognition,
     meta: { requiresAuth: true }
+  },
+  {
+    path: '/knowledge-base',
+    name: 'KnowledgeBase',
+    component: KnowledgeBase,
+    meta: { requiresAuth: true }
   }
 ]
 
@@ -5,6 +5,7 @@ module.exports = {
       '/api': {
         target: 'http://localhost:9090',
         changeOrigin: true,
+        ws: true, // 代理 WebSocket 聊天连接（/api/AI/ws）
         pathRewrite: {
           '^/api': '/api/v1'
         }